@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yehan2002/crashreport"
+	"github.com/yehan2002/crashreport/internal"
+)
+
+func importTraceback(args []string) int {
+	var output string
+
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.StringVar(&output, "o", "", "The file the crash report is written to. Defaults to FILE with the extension replaced by .crash.")
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintf(out, "Usage:\n")
+		fmt.Fprintf(out, "\t%s import [-o OUTPUT] FILE\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(out, "Converts a Go panic or fatal error traceback into a crash report.\n\n")
+		fmt.Fprintf(out, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() != 1 {
+		fmt.Fprintf(flags.Output(), "Expected exactly one argument got %d.\n\n", flags.NArg())
+		flags.Usage()
+		return 2
+	}
+
+	input := flags.Arg(0)
+	if output == "" {
+		output = strings.TrimSuffix(input, filepath.Ext(input)) + ".crash"
+	}
+
+	in, err := os.Open(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to open %s: %s\n", input, err)
+		return 1
+	}
+	defer in.Close()
+
+	err = internal.WriteFile(output, false, func(w io.Writer) error { return crashreport.ImportTraceback(in, w) })
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to import %s: %s\n", input, err)
+		return 1
+	}
+
+	fmt.Printf("Crash report written to %s\n", output)
+	return 0
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yehan2002/crashreport/report"
+)
+
+func TestImportTraceback(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "panic.log")
+	if err := os.WriteFile(input, []byte(childTraceback), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := importTraceback([]string{input}); code != 0 {
+		t.Fatalf("import exited with %d", code)
+	}
+
+	r, err := report.Open(filepath.Join(dir, "panic.crash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.Reason() != "panic: child failed" {
+		t.Errorf("unexpected reason %q", r.Reason())
+	}
+
+	output := filepath.Join(dir, "out.crash")
+	if code := importTraceback([]string{"-o", output, input}); code != 0 {
+		t.Fatalf("import exited with %d", code)
+	}
+	if _, err = os.Stat(output); err != nil {
+		t.Errorf("report was not written to -o: %v", err)
+	}
+
+	if code := importTraceback([]string{filepath.Join(dir, "missing.log")}); code != 1 {
+		t.Errorf("expected exit code 1 for a missing file, got %d", code)
+	}
+}
@@ -11,6 +11,15 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "supervise":
+			os.Exit(supervise(os.Args[2:]))
+		case "import":
+			os.Exit(importTraceback(os.Args[2:]))
+		}
+	}
+
 	var port uint
 	var openBrowser bool
 	flag.UintVar(&port, "port", 0, "The port to use. Defaults to using a random port.")
@@ -24,7 +33,9 @@ func main() {
 			fmt.Fprintf(out, "crashreport is a tool for viewing crash reports:\n\n")
 		}
 		fmt.Fprintf(out, "Usage:\n")
-		fmt.Fprintf(out, "\t%s [OPTION]... FILE\n\n", bin)
+		fmt.Fprintf(out, "\t%s [OPTION]... FILE\n", bin)
+		fmt.Fprintf(out, "\t%s supervise [OPTION]... -- COMMAND [ARG]...\n", bin)
+		fmt.Fprintf(out, "\t%s import [-o OUTPUT] FILE\n\n", bin)
 		fmt.Fprintf(out, "Options:\n")
 		flag.PrintDefaults()
 	}
@@ -52,7 +63,13 @@ func main() {
 	}
 	defer file.Close()
 
-	err = ui.Run(file, int(port), openBrowser)
+	stat, err := file.Stat()
+	if err != nil {
+		fmt.Printf("Unable to stat %s: %s\n", fileName, err)
+		return
+	}
+
+	err = ui.Run(file, stat.Size(), int(port), openBrowser)
 	if err != nil {
 		fmt.Fprintln(flag.CommandLine.Output(), err.Error())
 	}
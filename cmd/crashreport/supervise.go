@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/yehan2002/crashreport/internal"
+)
+
+// restart policies for the supervised process.
+const (
+	restartNever     = "never"
+	restartOnFailure = "on-failure"
+	restartAlways    = "always"
+)
+
+// supervisor runs a child process and writes crash reports when it panics.
+type supervisor struct {
+	dir         string
+	lines       int
+	restart     string
+	maxRestarts int
+	backoff     time.Duration
+
+	args []string
+
+	// stopped is set once the supervisor receives a signal.
+	// The child is not restarted after this.
+	stopped bool
+	mux     sync.Mutex
+}
+
+func supervise(args []string) int {
+	s := &supervisor{}
+
+	flags := flag.NewFlagSet("supervise", flag.ExitOnError)
+	flags.StringVar(&s.dir, "dir", ".", "The directory crash reports are written to.")
+	flags.IntVar(&s.lines, "lines", 100, "The number of lines of output included in the crash report.")
+	flags.StringVar(&s.restart, "restart", restartNever, "When to restart the process: never, on-failure or always.")
+	flags.IntVar(&s.maxRestarts, "max-restarts", 0, "The maximum number of restarts. 0 means no limit.")
+	flags.DurationVar(&s.backoff, "backoff", time.Second, "The delay before the first restart. This is doubled after every restart up to 1 minute.")
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintf(out, "Usage:\n")
+		fmt.Fprintf(out, "\t%s supervise [OPTION]... -- COMMAND [ARG]...\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(out, "Runs COMMAND and writes a crash report if it panics.\n\n")
+		fmt.Fprintf(out, "Options:\n")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	s.args = flags.Args()
+	if len(s.args) == 0 {
+		fmt.Fprintf(flags.Output(), "Command was not specified\n\n")
+		flags.Usage()
+		return 2
+	}
+
+	switch s.restart {
+	case restartNever, restartOnFailure, restartAlways:
+	default:
+		fmt.Fprintf(flags.Output(), "Invalid restart policy %q\n\n", s.restart)
+		flags.Usage()
+		return 2
+	}
+
+	if s.lines < 0 {
+		fmt.Fprintf(flags.Output(), "Invalid number of lines %d\n\n", s.lines)
+		flags.Usage()
+		return 2
+	}
+
+	return s.run()
+}
+
+// run runs the child process until it should no longer be restarted.
+// The exit code of the last run is returned.
+func (s *supervisor) run() int {
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	backoff := s.backoff
+	for restarts := 0; ; restarts++ {
+		code, err := s.runOnce(sig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "crashreport: %s\n", err)
+			return 1
+		}
+
+		s.mux.Lock()
+		stopped := s.stopped
+		s.mux.Unlock()
+
+		switch {
+		case stopped, s.restart == restartNever, s.restart == restartOnFailure && code == 0:
+			return code
+		case s.maxRestarts > 0 && restarts >= s.maxRestarts:
+			fmt.Fprintf(os.Stderr, "crashreport: not restarting %s: restarted %d times\n", s.args[0], restarts)
+			return code
+		}
+
+		fmt.Fprintf(os.Stderr, "crashreport: restarting %s in %s\n", s.args[0], backoff)
+		select {
+		case <-time.After(backoff):
+		case <-sig:
+			return code
+		}
+
+		if backoff *= 2; backoff > time.Minute {
+			backoff = time.Minute
+		}
+	}
+}
+
+// runOnce runs the child process once and returns its exit code.
+func (s *supervisor) runOnce(sig chan os.Signal) (int, error) {
+	cmd := exec.Command(s.args[0], s.args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return 0, err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case v := <-sig:
+				s.mux.Lock()
+				s.stopped = true
+				s.mux.Unlock()
+				cmd.Process.Signal(v)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	out := s.tee(stderr, os.Stderr)
+	err = cmd.Wait()
+
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		return 0, err
+	}
+
+	// a traceback printed by a process that exited successfully was recovered
+	// or printed on purpose, so it is not reported.
+	if out.traceback.Len() != 0 && !cmd.ProcessState.Success() {
+		path, err := s.writeReport(out, cmd.ProcessState)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "crashreport: unable to write crash report: %s\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "crashreport: crash report written to %s\n", path)
+		}
+	}
+
+	return code, nil
+}
+
+// maxTraceback the maximum size of a captured traceback in bytes.
+// The rest of the traceback is discarded.
+var maxTraceback = 64 << 20
+
+// output the captured output of a child process.
+type output struct {
+	// lines the last lines of output.
+	lines []string
+	// traceback the last traceback printed by the child process.
+	traceback strings.Builder
+	// truncated is set if the traceback was longer than maxTraceback.
+	truncated bool
+}
+
+// tee copies r to w until r is closed and captures the output.
+func (s *supervisor) tee(r io.Reader, w io.Writer) *output {
+	out := &output{}
+	inTraceback := false
+	// sawGoroutine is set once the goroutines of the current traceback are printed.
+	// Lines like "runtime: " and "fatal error: " that appear before this belong
+	// to the same traceback, later ones start a new traceback.
+	sawGoroutine := false
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Text()
+		fmt.Fprintln(w, line)
+
+		if out.lines = append(out.lines, line); len(out.lines) > s.lines {
+			out.lines = out.lines[len(out.lines)-s.lines:]
+		}
+
+		if internal.IsTracebackStart(line) && (!inTraceback || sawGoroutine) {
+			out.traceback.Reset()
+			out.truncated = false
+			inTraceback, sawGoroutine = true, false
+		}
+		if !inTraceback {
+			continue
+		}
+
+		if strings.HasPrefix(line, "goroutine ") {
+			sawGoroutine = true
+		}
+		if out.truncated || out.traceback.Len()+len(line)+1 > maxTraceback {
+			out.truncated = true
+			continue
+		}
+		out.traceback.WriteString(line)
+		out.traceback.WriteByte('\n')
+	}
+
+	// drain the rest of the output if the scanner stopped early.
+	_, _ = io.Copy(w, r)
+	return out
+}
+
+// writeReport writes a crash report for a child process that panicked.
+func (s *supervisor) writeReport(out *output, state *os.ProcessState) (string, error) {
+	report, err := internal.ParseTraceback(out.traceback.String())
+	if err != nil {
+		return "", err
+	}
+
+	hostname, _ := os.Hostname()
+	report.Metadata = &internal.Metadata{}
+	report.Metadata.Set("command", strings.Join(s.args, " "))
+	report.Metadata.Set("exit_status", state.String())
+	report.Metadata.Set("exit_code", strconv.Itoa(state.ExitCode()))
+	report.Metadata.Set("pid", strconv.Itoa(state.Pid()))
+	report.Metadata.Set("host.name", hostname)
+	report.Metadata.Set("host.os", runtime.GOOS)
+	report.Metadata.Set("host.arch", runtime.GOARCH)
+	report.Metadata.Set("host.cpus", strconv.Itoa(runtime.NumCPU()))
+	if out.truncated {
+		report.Metadata.Set("traceback_truncated", "true")
+	}
+
+	report.Attachments = append(report.Attachments, &internal.Attachment{
+		Name: "output.txt",
+		Data: []byte(strings.Join(out.lines, "\n") + "\n"),
+	})
+
+	if err = os.MkdirAll(s.dir, 0o755); err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("panic-%s-%d.crash", time.Now().Format("20060102-150405.000"), state.Pid())
+	path := filepath.Join(s.dir, name)
+
+	return path, internal.WriteFile(path, false, report.Write)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// childEnv the environment variable that makes the test binary act as a supervised child.
+// The value is the exit code of the child.
+const childEnv = "CRASHREPORT_TEST_CHILD"
+
+// childTraceback the traceback printed by the child.
+const childTraceback = `panic: child failed
+
+goroutine 1 [running]:
+main.main()
+	/tmp/main.go:5 +0x25
+exit status 2
+`
+
+func TestMain(m *testing.M) {
+	if code := os.Getenv(childEnv); code != "" {
+		fmt.Fprintln(os.Stderr, "starting")
+		fmt.Fprint(os.Stderr, childTraceback)
+		var exit int
+		fmt.Sscan(code, &exit)
+		os.Exit(exit)
+	}
+	os.Exit(m.Run())
+}
+
+func TestTee(t *testing.T) {
+	s := &supervisor{lines: 2}
+	input := "log line\nruntime: out of memory\nfatal error: out of memory\n\ngoroutine 1 [running]:\nmain.main()\nmore\n"
+
+	var copied strings.Builder
+	out := s.tee(strings.NewReader(input), &copied)
+
+	if copied.String() != input {
+		t.Errorf("output was not copied: %q", copied.String())
+	}
+	if strings.Join(out.lines, "\n") != "main.main()\nmore" {
+		t.Errorf("unexpected lines %q", out.lines)
+	}
+
+	// the "runtime: " line belongs to the same traceback as the "fatal error: " line.
+	expected := strings.TrimPrefix(input, "log line\n")
+	if out.traceback.String() != expected {
+		t.Errorf("got traceback %q, expected %q", out.traceback.String(), expected)
+	}
+}
+
+func TestTeeRestart(t *testing.T) {
+	s := &supervisor{lines: 10}
+	first := "panic: first\n\ngoroutine 1 [running]:\nmain.a()\n"
+	second := "panic: second\n\ngoroutine 1 [running]:\nmain.b()\n"
+
+	out := s.tee(strings.NewReader(first+"log line\n"+second), io.Discard)
+	if out.traceback.String() != second {
+		t.Errorf("expected only the last traceback, got %q", out.traceback.String())
+	}
+}
+
+func TestTeeLimit(t *testing.T) {
+	prev := maxTraceback
+	maxTraceback = 64
+	t.Cleanup(func() { maxTraceback = prev })
+
+	s := &supervisor{lines: 10}
+	input := "panic: x\n\ngoroutine 1 [running]:\n" + strings.Repeat("main.f()\n", 100)
+
+	out := s.tee(strings.NewReader(input), io.Discard)
+	if !out.truncated {
+		t.Error("traceback was not truncated")
+	}
+	if out.traceback.Len() > maxTraceback {
+		t.Errorf("traceback is %d bytes", out.traceback.Len())
+	}
+
+	// a new traceback resets the limit.
+	out = s.tee(strings.NewReader(input+"panic: y\n"), io.Discard)
+	if out.truncated || out.traceback.String() != "panic: y\n" {
+		t.Errorf("traceback was not restarted: %q", out.traceback.String())
+	}
+}
+
+func TestRunOnce(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	for _, tt := range []struct {
+		code   string
+		report bool
+	}{{"0", false}, {"2", true}} {
+		t.Run("exit "+tt.code, func(t *testing.T) {
+			t.Setenv(childEnv, tt.code)
+
+			dir := t.TempDir()
+			s := &supervisor{dir: dir, lines: 10, args: []string{exe}}
+			if _, err := s.runOnce(make(chan os.Signal)); err != nil {
+				t.Fatal(err)
+			}
+
+			files, _ := filepath.Glob(filepath.Join(dir, "*.crash"))
+			if tt.report && len(files) != 1 {
+				t.Errorf("expected a report, got %v", files)
+			} else if !tt.report && len(files) != 0 {
+				t.Errorf("report was written for a successful exit: %v", files)
+			}
+		})
+	}
+}
+
+func TestSuperviseInvalidLines(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Setenv(childEnv, "0")
+
+	if code := supervise([]string{"-dir", t.TempDir(), "-lines", "-1", "--", exe}); code != 2 {
+		t.Errorf("got exit code %d for a negative number of lines, expected 2", code)
+	}
+}
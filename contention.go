@@ -0,0 +1,16 @@
+package crashreport
+
+import (
+	"runtime"
+
+	"github.com/yehan2002/crashreport/internal"
+)
+
+// EnableContentionProfiling enables the block and mutex profiles.
+// Without this [ProfileBlock] and [ProfileMutex] are empty.
+// rate is passed to [runtime.SetBlockProfileRate] and fraction to [runtime.SetMutexProfileFraction].
+// Passing zero disables the corresponding profile.
+func EnableContentionProfiling(rate, fraction int) {
+	internal.SetBlockProfileRate(rate)
+	runtime.SetMutexProfileFraction(fraction)
+}
@@ -0,0 +1,52 @@
+package crashreport
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+)
+
+// contextKey the key used to store values in a context.
+type contextKey struct{}
+
+// WithContextValues returns a copy of ctx that carries the given key value pairs.
+// Reports created using [FromContext] include these values.
+// kv must contain alternating keys and values, a missing value is treated as empty.
+// Keys and values are formatted using [fmt.Sprint].
+func WithContextValues(ctx context.Context, kv ...any) context.Context {
+	parent, _ := ctx.Value(contextKey{}).(map[string]string)
+
+	values := make(map[string]string, len(parent)+len(kv)/2)
+	for k, v := range parent {
+		values[k] = v
+	}
+
+	for i := 0; i < len(kv); i += 2 {
+		var value string
+		if i+1 < len(kv) {
+			value = fmt.Sprint(kv[i+1])
+		}
+		values[fmt.Sprint(kv[i])] = value
+	}
+
+	return context.WithValue(ctx, contextKey{}, values)
+}
+
+// FromContext creates a new crash report that includes the values added to ctx
+// using [WithContextValues] and the pprof labels set on ctx.
+func FromContext(ctx context.Context) *CrashReport {
+	c := NewCrashReport()
+
+	if values, ok := ctx.Value(contextKey{}).(map[string]string); ok {
+		for k, v := range values {
+			c.Set(k, v)
+		}
+	}
+
+	pprof.ForLabels(ctx, func(key, value string) bool {
+		c.c.Metadata.SetLabel(key, value)
+		return true
+	})
+
+	return c
+}
@@ -0,0 +1,89 @@
+package crashreport
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"runtime/pprof"
+	"testing"
+)
+
+// findReports returns the reports of the given kind in dir.
+func findReports(t *testing.T, dir, kind string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, kind+"-*.crash"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestWithContextValues(t *testing.T) {
+	ctx := WithContextValues(context.Background(), "user", 1, "route", "/a")
+	child := WithContextValues(ctx, "route", "/b", "missing")
+
+	values := FromContext(child).c.Metadata.Values
+	expected := map[string]string{"user": "1", "route": "/b", "missing": ""}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("got %v, expected %v", values, expected)
+	}
+
+	// the parent context must not be modified.
+	if route := FromContext(ctx).c.Metadata.Values["route"]; route != "/a" {
+		t.Errorf("parent value was modified: %q", route)
+	}
+
+	if m := FromContext(context.Background()).c.Metadata; !m.Empty() {
+		t.Errorf("report from empty context has metadata %+v", m)
+	}
+}
+
+func TestFromContextLabels(t *testing.T) {
+	ctx := WithContextValues(context.Background(), "trace", "abc")
+	ctx = pprof.WithLabels(ctx, pprof.Labels("handler", "index"))
+
+	var buf bytes.Buffer
+	if err := FromContext(ctx).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	r := readReport(t, buf.Bytes())
+	if r.Metadata()["trace"] != "abc" {
+		t.Errorf("value was not written: %v", r.Metadata())
+	}
+	if r.Labels()["handler"] != "index" {
+		t.Errorf("label was not written: %v", r.Labels())
+	}
+}
+
+func TestRecoverContext(t *testing.T) {
+	dir := t.TempDir()
+	configure(t, Options{Dir: dir})
+
+	ctx := WithContextValues(context.Background(), "user", "42")
+	ctx = pprof.WithLabels(ctx, pprof.Labels("route", "/panic"))
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("expected the panic to continue, got %v", r)
+			}
+		}()
+		defer RecoverContext(ctx)
+		panic("boom")
+	}()
+
+	files := findReports(t, dir, "panic")
+	if len(files) != 1 {
+		t.Fatalf("expected 1 report, got %v", files)
+	}
+
+	r := openReport(t, files[0])
+	if r.Reason() != "panic: boom" {
+		t.Errorf("unexpected reason %q", r.Reason())
+	}
+	if r.Metadata()["user"] != "42" || r.Labels()["route"] != "/panic" {
+		t.Errorf("context was not included: %v %v", r.Metadata(), r.Labels())
+	}
+}
@@ -1,8 +1,15 @@
 package crashreport
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
-	"os"
+	"io/fs"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"time"
 
 	"github.com/yehan2002/crashreport/internal"
 )
@@ -22,9 +29,29 @@ const (
 	ProfileAll = ProfileHeap | ProfileBlock | ProfileMutex | ProfileAllocs | ProfileGoroutines | ProfileThreadCreate
 )
 
+// Baseline records the current heap, allocs, block and mutex profiles.
+// Reports created using [CrashReport.IncludeDelta] include the difference between
+// the profiles at the time the report is created and this baseline.
+// Calling Baseline again replaces the previous baseline.
+func Baseline() error { return internal.TakeBaseline() }
+
 // CrashReport a crash report.
 // The Write/WriteTo methods may be used multiple times.
-type CrashReport struct{ c internal.Config }
+type CrashReport struct {
+	c internal.Config
+
+	// syncDir syncs the directory after the report is written by [CrashReport.WriteTo].
+	syncDir bool
+	// crash the report is written because the program is crashing.
+	// The crash is recorded in the crash history. See [CrashLoopState].
+	crash bool
+	// history the crash history was already summarized when the report was produced automatically.
+	history bool
+	// noRateLimit the report is written even if [Options.RateLimit] would suppress it.
+	noRateLimit bool
+	// id the id of the report. See [CrashReport.ID].
+	id string
+}
 
 // NewCrashReport creates a new crash report
 func NewCrashReport(reason ...string) *CrashReport {
@@ -35,66 +62,283 @@ func NewCrashReport(reason ...string) *CrashReport {
 // Include includes the given profiles in the crash report
 func (c *CrashReport) Include(p Profiles) *CrashReport { p.Add(&c.c); return c }
 
-// IncludeCustom includes a custom profile
+// IncludeCustom includes a custom profile registered using [pprof.NewProfile].
+// The profile is looked up when the report is written instead of when it is included,
+// since reports are often configured before the packages that register their profiles
+// are initialized. If it does not exist at that time, it is not included and a warning
+// is recorded in the report. Use [CrashReport.Validate] to check the name earlier.
 func (c *CrashReport) IncludeCustom(name string) *CrashReport {
-	c.c.Profiles[name] = struct{}{}
+	if c.checkProfile(name) {
+		c.c.Profiles[name] = struct{}{}
+	}
+	return c
+}
+
+// IncludeProfile includes the given profile. The profile does not need to be registered
+// with the same name, so profiles that are not returned by [pprof.Lookup] may be included.
+func (c *CrashReport) IncludeProfile(p *pprof.Profile) *CrashReport {
+	return c.IncludeProfileNamed(p, "")
+}
+
+// IncludeProfileNamed is like [CrashReport.IncludeProfile] but the profile is shown
+// in the viewer using the given name instead of the name of the profile.
+func (c *CrashReport) IncludeProfileNamed(p *pprof.Profile, name string) *CrashReport {
+	if p == nil {
+		c.warn("profiles", errors.New("profile is nil"))
+		return c
+	}
+	if p.Name() == "" {
+		c.warn("profiles", errors.New("profile name is empty"))
+		return c
+	}
+
+	if c.c.Custom == nil {
+		c.c.Custom = map[string]*internal.CustomProfile{}
+	}
+	c.c.Custom[p.Name()] = &internal.CustomProfile{Profile: p, Name: name}
+	c.c.Profiles[p.Name()] = struct{}{}
+	return c
+}
+
+// IncludeText includes the given profiles and also includes them in text form
+// using the given debug level. See [runtime/pprof.Profile.WriteTo] for the meaning of debug.
+// For example the goroutine profile with debug=1 groups goroutines with identical
+// stacks and debug=2 prints every goroutine with its stack.
+func (c *CrashReport) IncludeText(p Profiles, debug int) *CrashReport {
+	p.AddDebug(&c.c, debug)
+	return c
+}
+
+// IncludeCustomText includes a custom profile in text form using the given debug level.
+// The profile is validated like [CrashReport.IncludeCustom].
+func (c *CrashReport) IncludeCustomText(name string, debug int) *CrashReport {
+	if c.checkProfile(name) {
+		c.c.SetDebug(name, debug)
+	}
 	return c
 }
 
+// checkProfile checks if a profile with the given name can be included in the report.
+// A warning is recorded if it cannot be included. Unknown profiles are reported
+// by [CrashReport.Validate] since they may be registered later.
+func (c *CrashReport) checkProfile(name string) bool {
+	if name == "" {
+		c.warn("profiles", errors.New("profile name is empty"))
+		return false
+	}
+	return true
+}
+
+// warn records a problem with the configuration of the report.
+func (c *CrashReport) warn(name string, err error) {
+	c.c.Warnings = append(c.c.Warnings, &internal.Section{Name: name, Stage: internal.StageConfig, Error: err.Error()})
+}
+
+// Validate returns an error describing the problems with the configuration of the report,
+// like profiles included using [CrashReport.IncludeCustom] that are not registered yet, or
+// profiles whose names only differ in path separators and would be stored in the same file.
+// These problems do not prevent the report from being written and are also recorded in the report.
+func (c *CrashReport) Validate() error {
+	_, profiles := c.c.CheckProfiles()
+	warnings := append(append([]*internal.Section(nil), c.c.Warnings...), profiles...)
+	if len(warnings) == 0 {
+		return nil
+	}
+
+	problems := make([]string, 0, len(warnings))
+	for _, w := range warnings {
+		problems = append(problems, w.Name+": "+w.Error)
+	}
+	return fmt.Errorf("crashreport: invalid report: %s", strings.Join(problems, "; "))
+}
+
+// IncludeDelta includes delta profiles for the heap, allocs, block and mutex profiles
+// in the report. A delta profile is the difference between the current profile and
+// the profile recorded by [Baseline]. Delta profiles are only included for profiles
+// that are also included in the report.
+func (c *CrashReport) IncludeDelta() *CrashReport { c.c.Delta = true; return c }
+
 // IncludeFile includes the given file in the crash report.
-// Any errors when including these files are silently ignored.
+// Errors when including these files are recorded in the report
+// and do not prevent the report from being written.
+// Files with the same name as another included file are stored with a numbered suffix.
 func (c *CrashReport) IncludeFile(path string) *CrashReport {
-	c.c.Files = append(c.c.Files, path)
+	if c.checkInclude(path) {
+		c.c.Files = append(c.c.Files, path)
+	}
 	return c
 }
 
+// IncludeBytes includes the given data in the crash report as a file with the given name.
+// Only the last element of name is used. See [CrashReport.IncludeFile].
+func (c *CrashReport) IncludeBytes(name string, data []byte) *CrashReport {
+	if c.checkInclude(name) {
+		c.c.Attachments = append(c.c.Attachments, &internal.Attachment{Name: filepath.Base(name), Data: data})
+	}
+	return c
+}
+
+// checkInclude checks if a file with the given name can be included in the report.
+// A warning is recorded if it cannot be included.
+func (c *CrashReport) checkInclude(name string) bool {
+	base := filepath.Base(name)
+	if name == "" || base == "." || !fs.ValidPath(base) || strings.ContainsAny(base, "\\\x00") {
+		c.warn("include", fmt.Errorf("invalid file name %q", name))
+		return false
+	}
+	return true
+}
+
 // NoStack excludes the stack from the crash report
 func (c *CrashReport) NoStack() *CrashReport { c.c.NoStack = true; return c }
 
 // NoSysInfo excludes system info from the crash report
 func (c *CrashReport) NoSysInfo() *CrashReport { c.c.NoSysInfo = true; return c }
 
+// Goroutine sets the id of the goroutine that crashed. The stacks of all goroutines are
+// included in the report and the fingerprint is computed from the stack of this goroutine.
+// Defaults to the goroutine writing the report.
+func (c *CrashReport) Goroutine(id int) *CrashReport {
+	c.c.GoroutineID = id
+	return c
+}
+
+// Set adds the given key value pair to the report.
+func (c *CrashReport) Set(key, value string) *CrashReport {
+	c.c.Metadata.Set(key, value)
+	return c
+}
+
 // Reason appends the given strings to the reason
 func (c *CrashReport) Reason(s ...string) *CrashReport {
 	c.c.Reason = append(c.c.Reason, s...)
 	return c
 }
 
-func (c *CrashReport) Write(w io.Writer) (err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			if e, ok := r.(error); ok {
-				err = e
-				return
-			}
-			panic(r)
-		}
-	}()
+// SectionTimeout sets the maximum amount of time spent on collecting or writing
+// a single section of the report. Sections that take longer are skipped and
+// marked as timed out in the report.
+func (c *CrashReport) SectionTimeout(d time.Duration) *CrashReport {
+	c.c.SectionTimeout = d
+	return c
+}
 
-	report, err := internal.Create(c.c)
-	if err != nil {
-		return err
+// SyncDir makes [CrashReport.WriteTo] sync the directory the report is written to
+// after the report is renamed into place, so the report is not lost on power loss.
+func (c *CrashReport) SyncDir() *CrashReport {
+	c.syncDir = true
+	return c
+}
+
+// ID returns the unique id of the report. The id is created when ID or one of the Write
+// methods is first called and is the same for every write of the report, so it can be
+// logged before or after the report is written.
+func (c *CrashReport) ID() string {
+	if c.id == "" {
+		c.id = internal.NewID()
 	}
+	return c.id
+}
+
+// Write writes the crash report to w.
+// See [CrashReport.ID] for the id of the written report.
+func (c *CrashReport) Write(w io.Writer) error {
+	return c.WriteContext(context.Background(), w)
+}
+
+// WriteContext writes the crash report to w.
+// Sections that are not finished before ctx is done are skipped and marked as
+// timed out. The written report is valid even if ctx is done while writing.
+func (c *CrashReport) WriteContext(ctx context.Context, w io.Writer) (err error) {
+	defer recoverError(&err)
 
-	err = report.Write(w)
+	report, err := internal.CreateContext(ctx, c.config())
 	if err != nil {
 		return err
 	}
 
-	return
+	return report.WriteContext(ctx, w)
 }
 
-// WriteTo writes the crash report to the given file
+// WriteTo writes the crash report to the given file.
+// The report is written to a temporary file in the same directory which is renamed once
+// the report is complete, so a partially written report is never left at filename.
 func (c *CrashReport) WriteTo(filename string) error {
-	f, err := os.Create(filename)
+	return c.WriteToContext(context.Background(), filename)
+}
+
+// WriteToContext writes the crash report to the given file like [CrashReport.WriteTo].
+// Sections that are not finished before ctx is done are skipped and marked as
+// timed out. The written report is valid even if ctx is done while writing.
+func (c *CrashReport) WriteToContext(ctx context.Context, filename string) error {
+	return c.writeFile(ctx, filename, nil)
+}
+
+// WriteText writes a human readable rendering of the crash report to w.
+// This includes the reason, build and system info, memory statistics, a summary of all
+// goroutines and the stack of the crashing goroutine. Profiles and files are not included.
+// Every line of the summary starts with "crashreport:" so it can be found in logs.
+func (c *CrashReport) WriteText(w io.Writer) (err error) {
+	defer recoverError(&err)
+
+	config := c.config()
+	config.Profiles = map[string]struct{}{}
+	config.Debug = nil
+	config.Delta = false
+	config.Files = nil
+	config.Attachments = nil
+
+	report, err := internal.Create(config)
 	if err != nil {
 		return err
 	}
 
-	err = c.Write(f)
+	return report.WriteText(w)
+}
+
+// writeFile writes the crash report to filename like [CrashReport.WriteTo].
+// If text is not nil, a text rendering of the same report is also written to text.
+func (c *CrashReport) writeFile(ctx context.Context, filename string, text io.Writer) (err error) {
+	defer recoverError(&err)
+
+	report, err := internal.CreateContext(ctx, c.config())
 	if err != nil {
 		return err
 	}
 
-	return f.Close()
+	if text != nil {
+		err = report.WriteText(text)
+	}
+
+	write := func(w io.Writer) error { return report.WriteContext(ctx, w) }
+	if werr := internal.WriteFile(filename, c.syncDir, write); err == nil {
+		err = werr
+	}
+	return err
+}
+
+// config returns the config used to create the report.
+// The identity of the report uses [Options.Service] and [Options.Instance].
+// The report includes a summary of the crash history recorded in [Options.Dir].
+func (c *CrashReport) config() internal.Config {
+	o := currentOptions()
+	config := c.c
+	config.Identity = internal.NewIdentity(o.Service, o.Instance)
+	config.Identity.ID = c.ID()
+	if !c.history {
+		config.History = crashHistory(o.Dir, "", "", false, o.CrashLoopWindow)
+	}
+	return config
+}
+
+// recoverError recovers panics with an error value and stores the error in err.
+// Other panics are not recovered.
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		if e, ok := r.(error); ok {
+			*err = e
+			return
+		}
+		panic(r)
+	}
 }
@@ -0,0 +1,150 @@
+package crashreport
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yehan2002/crashreport/report"
+)
+
+// openReport reads the report at path.
+func openReport(t *testing.T, path string) *report.Report {
+	t.Helper()
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to open report: %v", err)
+	}
+	return readReport(t, buf)
+}
+
+func TestWriteTo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.zip")
+	c := NewCrashReport("test", "reason").Set("key", "value")
+	if err := c.WriteTo(path); err != nil {
+		t.Fatal(err)
+	}
+
+	r := openReport(t, path)
+	if r.Reason() != "test\nreason" {
+		t.Errorf("unexpected reason %q", r.Reason())
+	}
+	if r.ID() != c.ID() {
+		t.Errorf("report id %q does not match %q", r.ID(), c.ID())
+	}
+	if r.Metadata()["key"] != "value" {
+		t.Errorf("metadata was not written: %v", r.Metadata())
+	}
+}
+
+func TestWriteToContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	path := filepath.Join(t.TempDir(), "report.zip")
+	if err := NewCrashReport("canceled").Include(ProfileHeap).WriteToContext(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+
+	r := openReport(t, path)
+	problems := r.Problems()
+	if len(problems) == 0 {
+		t.Fatal("no sections were skipped")
+	}
+	for _, p := range problems {
+		if !p.TimedOut {
+			t.Errorf("section %s %s was not marked as timed out: %s", p.Stage, p.Section, p.Error)
+		}
+	}
+}
+
+// readReport reads the report in buf.
+func readReport(t *testing.T, buf []byte) *report.Report {
+	t.Helper()
+	r, err := report.Read(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	return r
+}
+
+func TestWriteToReplaces(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.zip")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewCrashReport("new").SyncDir().WriteTo(path); err != nil {
+		t.Fatal(err)
+	}
+	if r := openReport(t, path); r.Reason() != "new" {
+		t.Errorf("unexpected reason %q", r.Reason())
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temporary files were left behind: %v", entries)
+	}
+}
+
+func TestID(t *testing.T) {
+	configure(t, Options{Service: "api", Instance: "api-1"})
+
+	c := NewCrashReport("id")
+	id := c.ID()
+	if len(id) != 26 || c.ID() != id {
+		t.Fatalf("unexpected id %q", id)
+	}
+	if other := NewCrashReport("id").ID(); other == id {
+		t.Error("reports have the same id")
+	}
+
+	// the id is the same for every write of the report.
+	var a, b bytes.Buffer
+	if err := c.Write(&a); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, buf := range [][]byte{a.Bytes(), b.Bytes()} {
+		r := readReport(t, buf)
+		if r.ID() != id {
+			t.Errorf("report id %q does not match %q", r.ID(), id)
+		}
+		if i := r.Identity(); i.Service != "api" || i.Instance != "api-1" || i.PID != os.Getpid() {
+			t.Errorf("unexpected identity %+v", i)
+		}
+	}
+
+	if !bytes.Contains(a.Bytes()[:bytes.Index(a.Bytes(), []byte("PK"))], []byte("id: "+id+"\n")) {
+		t.Error("the header does not contain the id")
+	}
+}
+
+func TestIncludeInvalidName(t *testing.T) {
+	c := NewCrashReport("include").IncludeBytes("", nil).IncludeBytes(".", nil).IncludeFile("").IncludeBytes("dir/ok.txt", []byte("ok"))
+	err := c.Validate()
+	if err == nil || strings.Count(err.Error(), "invalid file name") != 3 {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err = c.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r := readReport(t, buf.Bytes())
+	if files := r.Attachments(); len(files) != 1 || files[0].Name() != "ok.txt" {
+		t.Errorf("unexpected files %v", files)
+	}
+	for _, p := range r.Problems() {
+		if p.Stage == "read" {
+			t.Errorf("invalid entry was written: %s %s", p.Section, p.Error)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Package crashreporttest writes crash reports for failing, panicking or hung tests.
+package crashreporttest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yehan2002/crashreport"
+	"github.com/yehan2002/crashreport/internal"
+)
+
+// ArtifactsDir the directory reports are written to.
+// Defaults to the value of the CRASHREPORT_ARTIFACTS environment variable.
+// If this is empty reports are written to [os.TempDir].
+var ArtifactsDir = os.Getenv("CRASHREPORT_ARTIFACTS")
+
+// LogText writes a text rendering of each report to the test log in addition to the report file.
+// See [crashreport.CrashReport.WriteText].
+var LogText = false
+
+// TextOnly writes a text rendering of each report to the test log instead of writing a report file.
+var TextOnly = false
+
+// TimeoutMargin how long before the deadline of the test binary a report is written
+// for a test that is still running. See [testing.T.Deadline].
+// If -timeout is shorter than TimeoutMargin no report is written for timeouts.
+var TimeoutMargin = 5 * time.Second
+
+// Guard writes a crash report to [ArtifactsDir] if the test fails or panics, or
+// if it is still running shortly before the test binary is killed by -timeout.
+// The name of the test and subtest are included in the report.
+func Guard(t *testing.T) {
+	t.Helper()
+
+	// reports for timeouts are written by another goroutine,
+	// so the goroutine running the test is recorded as the crashing goroutine.
+	goroutine := internal.CurrentGoroutineID()
+
+	var once sync.Once
+	write := func(reason string) {
+		once.Do(func() {
+			path, err := writeReport(t, reason, goroutine)
+			if err != nil {
+				t.Logf("crashreporttest: unable to write crash report: %s", err)
+				return
+			}
+			if path != "" {
+				t.Logf("crashreporttest: crash report written to %s", path)
+			}
+		})
+	}
+
+	stop := func() {}
+	if deadline, ok := t.Deadline(); ok {
+		stop = deadlineTimer(deadline, func() {
+			write(fmt.Sprintf("test %s is about to time out", t.Name()))
+		})
+	}
+
+	t.Cleanup(func() {
+		stop()
+
+		// Cleanup functions of a panicking test run while the test goroutine is
+		// still panicking, so the panic shows up in the current stack.
+		buf := make([]byte, 1<<16)
+		if stack := string(buf[:runtime.Stack(buf, false)]); strings.Contains(stack, "\npanic(") {
+			write(fmt.Sprintf("test %s panicked", t.Name()))
+		} else if t.Failed() {
+			write(fmt.Sprintf("test %s failed", t.Name()))
+		}
+	})
+}
+
+// deadlineTimer calls fn [TimeoutMargin] before deadline.
+// If the deadline is closer than [TimeoutMargin] fn is never called.
+// The returned function stops the timer and waits for fn to return if it is running.
+// fn is never called after the returned function returns, so it is safe to call
+// [testing.T.Logf] from fn as long as the timer is stopped before the test finishes.
+func deadlineTimer(deadline time.Time, fn func()) (stop func()) {
+	d := time.Until(deadline) - TimeoutMargin
+	if d <= 0 {
+		return func() {}
+	}
+
+	var mu sync.Mutex
+	stopped := false
+	timer := time.AfterFunc(d, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !stopped {
+			fn()
+		}
+	})
+
+	return func() {
+		timer.Stop()
+		mu.Lock()
+		stopped = true
+		mu.Unlock()
+	}
+}
+
+// writeReport writes a crash report for the test running on the given goroutine.
+// The returned path is empty if only the text rendering was written.
+func writeReport(t *testing.T, reason string, goroutine int) (string, error) {
+	name := t.Name()
+	test, subtest, _ := strings.Cut(name, "/")
+
+	report := crashreport.NewCrashReport(reason).
+		Goroutine(goroutine).
+		Include(crashreport.ProfileHeap).
+		IncludeText(crashreport.ProfileGoroutines, 1).
+		Set("test.name", test)
+	if subtest != "" {
+		report.Set("test.subtest", subtest)
+	}
+
+	if LogText || TextOnly {
+		var text strings.Builder
+		if err := report.WriteText(&text); err != nil {
+			return "", err
+		}
+		t.Logf("crashreporttest: %s\n%s", reason, text.String())
+
+		if TextOnly {
+			return "", nil
+		}
+	}
+
+	dir := ArtifactsDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	file := strings.NewReplacer("/", "_", "\\", "_", ":", "_", " ", "_").Replace(name)
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.crash", file, time.Now().Format("20060102-150405.000")))
+	return path, report.WriteTo(path)
+}
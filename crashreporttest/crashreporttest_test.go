@@ -0,0 +1,146 @@
+package crashreporttest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yehan2002/crashreport/internal"
+	"github.com/yehan2002/crashreport/report"
+)
+
+func TestDeadlineTimer(t *testing.T) {
+	var called atomic.Int32
+	fn := func() { called.Add(1) }
+
+	// the deadline is closer than the margin.
+	stop := deadlineTimer(time.Now().Add(TimeoutMargin/2), fn)
+	stop()
+
+	// the deadline already passed.
+	stop = deadlineTimer(time.Now().Add(-time.Second), fn)
+	time.Sleep(10 * time.Millisecond)
+	stop()
+
+	if n := called.Load(); n != 0 {
+		t.Fatalf("fn was called %d times for a deadline within the margin", n)
+	}
+
+	stop = deadlineTimer(time.Now().Add(TimeoutMargin+10*time.Millisecond), fn)
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	if n := called.Load(); n != 1 {
+		t.Errorf("fn was called %d times", n)
+	}
+}
+
+func TestDeadlineTimerStop(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var finished atomic.Bool
+
+	stop := deadlineTimer(time.Now().Add(TimeoutMargin+10*time.Millisecond), func() {
+		close(started)
+		<-release
+		finished.Store(true)
+	})
+	<-started
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(release)
+	}()
+
+	// stop must wait for the running call to return.
+	stop()
+	if !finished.Load() {
+		t.Error("stop returned while fn was running")
+	}
+
+	var called atomic.Bool
+	stop = deadlineTimer(time.Now().Add(TimeoutMargin+20*time.Millisecond), func() { called.Store(true) })
+	stop()
+	time.Sleep(50 * time.Millisecond)
+	if called.Load() {
+		t.Error("fn was called after the timer was stopped")
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	ArtifactsDir = t.TempDir()
+	t.Cleanup(func() { ArtifactsDir = "" })
+
+	t.Run("sub/test", func(t *testing.T) {
+		goroutine := internal.CurrentGoroutineID()
+
+		// the report is written by another goroutine like reports for timeouts.
+		var path string
+		var err error
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			path, err = writeReport(t, "reason", goroutine)
+		}()
+		<-done
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Dir(path) != ArtifactsDir {
+			t.Errorf("report was written to %s", path)
+		}
+
+		r, err := report.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+
+		m := r.Metadata()
+		if m["test.name"] != "TestWriteReport" || m["test.subtest"] != "sub/test" {
+			t.Errorf("unexpected metadata %v", m)
+		}
+		if r.Reason() != "reason" {
+			t.Errorf("unexpected reason %q", r.Reason())
+		}
+		if r.GoroutineID() != goroutine {
+			t.Errorf("crashing goroutine %d, expected the test goroutine %d", r.GoroutineID(), goroutine)
+		}
+		if !strings.Contains(r.Stack(), "TestWriteReport.func") {
+			t.Error("the stack of the test goroutine was not included")
+		}
+	})
+}
+
+func TestWriteReportTempDir(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	t.Setenv("TMP", tmp)
+
+	path, err := writeReport(t, "temp dir", internal.CurrentGoroutineID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(path) != os.TempDir() {
+		t.Errorf("report was written to %s, expected it to be in %s", path, os.TempDir())
+	}
+}
+
+func TestWriteReportTextOnly(t *testing.T) {
+	ArtifactsDir = t.TempDir()
+	TextOnly = true
+	t.Cleanup(func() { ArtifactsDir, TextOnly = "", false })
+
+	path, err := writeReport(t, "text only", internal.CurrentGoroutineID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "" {
+		t.Errorf("a report file was written to %s", path)
+	}
+	if entries, _ := os.ReadDir(ArtifactsDir); len(entries) != 0 {
+		t.Errorf("files were written: %v", entries)
+	}
+}
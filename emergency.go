@@ -0,0 +1,181 @@
+package crashreport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/yehan2002/crashreport/internal"
+)
+
+// EmergencyConfig configures emergency mode. See [EnableEmergencyMode].
+type EmergencyConfig struct {
+	// Dir the directory the file used by emergency mode is reserved in.
+	// The reserved file is renamed to the report, so this should be on the same
+	// file system as the directories reports are written to. A full report is written
+	// instead if the reserved file cannot be renamed. Defaults to [Options.Dir].
+	Dir string
+
+	// Ballast the amount of memory reserved and released before a report is written.
+	// Defaults to 16MB.
+	Ballast int
+	// StackSize the size of the buffer reserved for the stack of the crashing goroutine.
+	// Defaults to 64KB.
+	StackSize int
+
+	// Headroom the amount of memory that must be available below the memory limit
+	// after the minimal report is written to also write a full report.
+	// Defaults to 64MB.
+	Headroom uint64
+	// MemoryLimit the memory limit of the process.
+	// Defaults to the limit set using [debug.SetMemoryLimit]. If neither is set,
+	// a full report is always attempted after the minimal report is written.
+	MemoryLimit int64
+}
+
+var (
+	emergencyMux     sync.Mutex
+	emergencyEnabled bool
+	emergencyConfig  EmergencyConfig
+	// emergency the reserved resources. This is nil while they are used by a report.
+	emergency *internal.Emergency
+)
+
+// EnableEmergencyMode reserves memory and an open file so automatically produced reports
+// (for example by [Recover] or a [Trigger]) can still be written when the process is
+// close to running out of memory.
+//
+// When a report is produced the reserved memory is released and a minimal report containing
+// the reason, the stack of the crashing goroutine and memory statistics is written using only
+// a small amount of memory. If enough memory is available afterwards (see [EmergencyConfig.Headroom]),
+// the minimal report is replaced with a full report and the resources are reserved again.
+// Otherwise emergency mode stays disabled until EnableEmergencyMode is called again.
+// If the minimal report cannot be written, a full report is written instead and
+// records a warning if emergency mode was disabled.
+//
+// Calling EnableEmergencyMode again replaces the previous configuration.
+func EnableEmergencyMode(cfg EmergencyConfig) error {
+	if cfg.Dir == "" {
+		cfg.Dir = currentOptions().Dir
+	}
+	if cfg.Ballast <= 0 {
+		cfg.Ballast = 16 << 20
+	}
+	if cfg.StackSize <= 0 {
+		cfg.StackSize = 64 << 10
+	}
+	if cfg.Headroom == 0 {
+		cfg.Headroom = 64 << 20
+	}
+
+	if err := os.MkdirAll(cfg.dir(), 0o755); err != nil {
+		return fmt.Errorf("unable to create report directory %s: %w", cfg.dir(), err)
+	}
+
+	// files reserved by processes that exited without disabling emergency mode are left behind.
+	internal.RemoveStaleEmergencyFiles(cfg.dir())
+
+	e, err := internal.NewEmergency(cfg.dir(), cfg.Ballast, cfg.StackSize)
+	if err != nil {
+		return err
+	}
+
+	emergencyMux.Lock()
+	defer emergencyMux.Unlock()
+
+	if emergency != nil {
+		emergency.Close()
+	}
+	emergency, emergencyConfig, emergencyEnabled = e, cfg, true
+	return nil
+}
+
+// DisableEmergencyMode releases the resources reserved by [EnableEmergencyMode]
+// and removes the reserved file. Files left behind by processes that exited while
+// emergency mode was enabled are removed the next time it is enabled.
+func DisableEmergencyMode() {
+	emergencyMux.Lock()
+	defer emergencyMux.Unlock()
+
+	if emergency != nil {
+		emergency.Close()
+		emergency = nil
+	}
+	emergencyEnabled = false
+}
+
+// takeEmergency takes the reserved resources so they are only used by a single report.
+// nil is returned if emergency mode is disabled or the resources are already in use.
+func takeEmergency() (*internal.Emergency, EmergencyConfig) {
+	emergencyMux.Lock()
+	defer emergencyMux.Unlock()
+
+	e := emergency
+	emergency = nil
+	return e, emergencyConfig
+}
+
+// dir returns the directory reports are written to.
+func (cfg *EmergencyConfig) dir() string {
+	if cfg.Dir == "" {
+		return "."
+	}
+	return cfg.Dir
+}
+
+// memoryAllows checks if there is enough memory available to write a full report.
+func (cfg *EmergencyConfig) memoryAllows() bool {
+	headroom, ok := internal.MemoryHeadroom(cfg.MemoryLimit)
+	return !ok || headroom >= cfg.Headroom
+}
+
+// writeEmergency writes a report to path using the reserved resources e.
+// The reserved file is renamed to path, so path should be on the same file system as [EmergencyConfig.Dir].
+// If the minimal report cannot be written, the full report is written instead.
+func writeEmergency(e *internal.Emergency, cfg EmergencyConfig, path string, c *CrashReport, o *Options) (string, error) {
+	e.Release()
+	if err := e.WriteMinimal(path, c.config()); err != nil {
+		c.warn("emergency", fmt.Errorf("unable to write the minimal report: %w", err))
+		// the resources are reserved before the report is written so the report records
+		// if emergency mode is still enabled.
+		if !cfg.memoryAllows() || !rearmEmergency(cfg) {
+			c.warn("emergency", errors.New("emergency mode is disabled until EnableEmergencyMode is called again"))
+		}
+		return path, c.writeFile(context.Background(), path, o.Text)
+	}
+
+	if !cfg.memoryAllows() {
+		return path, nil
+	}
+
+	// the minimal report is kept if the full report cannot be written.
+	_ = c.writeFile(context.Background(), path, o.Text)
+
+	if cfg.memoryAllows() {
+		rearmEmergency(cfg)
+	}
+
+	return path, nil
+}
+
+// rearmEmergency reserves the resources used by emergency mode again after they were used by a report.
+// false is returned if the resources were not reserved.
+func rearmEmergency(cfg EmergencyConfig) bool {
+	e, err := internal.NewEmergency(cfg.dir(), cfg.Ballast, cfg.StackSize)
+	if err != nil {
+		return false
+	}
+
+	emergencyMux.Lock()
+	defer emergencyMux.Unlock()
+
+	// emergency mode may have been disabled or enabled again while the report was written.
+	if !emergencyEnabled || emergency != nil || emergencyConfig != cfg {
+		e.Close()
+		return emergencyEnabled && emergency != nil
+	}
+	emergency = e
+	return true
+}
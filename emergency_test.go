@@ -0,0 +1,154 @@
+package crashreport
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// reservedFiles returns the files reserved by emergency mode in dir.
+func reservedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, ".crashreport-emergency-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestEmergencyMode(t *testing.T) {
+	reserved, dir := t.TempDir(), t.TempDir()
+	configure(t, Options{Dir: dir, RateLimit: -1, CrashLoopWindow: -1})
+
+	// a file left behind by a process that is no longer running.
+	stale := filepath.Join(reserved, ".crashreport-emergency-1073741824-1")
+	if err := os.WriteFile(stale, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EnableEmergencyMode(EmergencyConfig{Dir: reserved, Ballast: 1 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(DisableEmergencyMode)
+
+	if _, err := os.Stat(stale); runtime.GOOS != "windows" && err == nil {
+		t.Error("stale reserved file was not removed")
+	}
+	os.Remove(stale)
+
+	files := reservedFiles(t, reserved)
+	if len(files) != 1 {
+		t.Fatalf("unexpected reserved files %v", files)
+	}
+
+	// the report is written to the directory passed to writeAuto, not the reserved directory.
+	other := t.TempDir()
+	path, err := writeAuto(other, "test", "key", NewCrashReport("emergency"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(path) != other {
+		t.Errorf("report was written to %s", path)
+	}
+
+	r := openReport(t, path)
+	if r.Reason() != "emergency" {
+		t.Errorf("unexpected reason %q", r.Reason())
+	}
+	// there is no memory limit, so the minimal report is replaced with a full report.
+	for _, p := range r.Problems() {
+		if p.Section == "emergency" {
+			t.Error("the minimal report was not replaced")
+		}
+	}
+
+	// the resources are reserved again after the report was written.
+	files = reservedFiles(t, reserved)
+	if len(files) != 1 {
+		t.Fatalf("resources were not reserved again: %v", files)
+	}
+
+	DisableEmergencyMode()
+	if files = reservedFiles(t, reserved); len(files) != 0 {
+		t.Errorf("reserved files were not removed: %v", files)
+	}
+}
+
+func TestEmergencyModeMinimal(t *testing.T) {
+	dir := t.TempDir()
+	configure(t, Options{Dir: dir, RateLimit: -1, CrashLoopWindow: -1})
+
+	// the headroom can never be available, so only the minimal report is written.
+	err := EnableEmergencyMode(EmergencyConfig{Ballast: 1 << 20, MemoryLimit: 1 << 20, Headroom: 1 << 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(DisableEmergencyMode)
+
+	path, err := writeAuto("", "test", "key", NewCrashReport("minimal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := openReport(t, path)
+	if r.Reason() != "minimal" || !strings.Contains(r.Stack(), "TestEmergencyModeMinimal") {
+		t.Errorf("unexpected report %q\n%s", r.Reason(), r.Stack())
+	}
+
+	minimal := false
+	for _, p := range r.Problems() {
+		minimal = minimal || p.Section == "emergency"
+	}
+	if !minimal {
+		t.Error("the report is not marked as minimal")
+	}
+
+	// emergency mode stays disabled until it is enabled again.
+	if files := reservedFiles(t, dir); len(files) != 0 {
+		t.Errorf("resources were reserved again: %v", files)
+	}
+	if e, _ := takeEmergency(); e != nil {
+		t.Error("resources were reserved again")
+	}
+}
+
+func TestEmergencyModeFallback(t *testing.T) {
+	dir := t.TempDir()
+	configure(t, Options{Dir: dir, RateLimit: -1, CrashLoopWindow: -1})
+
+	if err := EnableEmergencyMode(EmergencyConfig{Ballast: 1 << 20}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(DisableEmergencyMode)
+
+	// the reserved file was already used, so the minimal report cannot be written.
+	e, cfg := takeEmergency()
+	e.Close()
+
+	o := currentOptions()
+	path := filepath.Join(t.TempDir(), "report.crash")
+	if _, err := writeEmergency(e, cfg, path, NewCrashReport("fallback"), &o); err != nil {
+		t.Fatal(err)
+	}
+
+	r := openReport(t, path)
+	if r.Reason() != "fallback" {
+		t.Errorf("unexpected reason %q", r.Reason())
+	}
+	var problems []string
+	for _, p := range r.Problems() {
+		if p.Section == "emergency" {
+			problems = append(problems, p.Error)
+		}
+	}
+	if len(problems) != 1 || !strings.Contains(problems[0], "unable to write the minimal report") {
+		t.Errorf("unexpected problems %q", problems)
+	}
+
+	// the resources are reserved again.
+	if files := reservedFiles(t, dir); len(files) != 1 {
+		t.Errorf("resources were not reserved again: %v", files)
+	}
+}
@@ -0,0 +1,154 @@
+package crashreport
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var (
+	exitHooksMux sync.Mutex
+	exitHooks    []*exitHook
+)
+
+// exitHook a function registered using [OnExit].
+type exitHook struct{ fn func() }
+
+// OnExit registers fn to be called by [Exit] after the crash report is written
+// and before the process exits. This can be used to flush logs or buffered data.
+// Hooks are called in the reverse order they were registered.
+// The returned function unregisters fn.
+func OnExit(fn func()) (unregister func()) {
+	hook := &exitHook{fn: fn}
+
+	exitHooksMux.Lock()
+	exitHooks = append(exitHooks, hook)
+	exitHooksMux.Unlock()
+
+	return func() {
+		exitHooksMux.Lock()
+		defer exitHooksMux.Unlock()
+
+		for i, h := range exitHooks {
+			if h == hook {
+				exitHooks = append(exitHooks[:i:i], exitHooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// runExitHooks calls every function registered using [OnExit].
+// Panics in hooks are ignored so every hook is called.
+func runExitHooks() {
+	exitHooksMux.Lock()
+	hooks := append([]*exitHook(nil), exitHooks...)
+	exitHooksMux.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		func() {
+			defer func() { _ = recover() }()
+			hooks[i].fn()
+		}()
+	}
+}
+
+// Exit writes a crash report with the given reason to [Options.Dir], calls the
+// functions registered using [OnExit] and then exits the process with the given code.
+// Exit can be used instead of [os.Exit] in code paths that terminate the process
+// because of an unrecoverable error.
+func Exit(code int, reason string) {
+	exit(NewCrashReport(reason), code)
+}
+
+// exit writes report, calls the exit hooks and exits the process with the given code.
+// This must be called from the goroutine that is exiting the process.
+func exit(report *CrashReport, code int) {
+	writeExit(report)
+	runExitHooks()
+	os.Exit(code)
+}
+
+// writeExit writes report for a process that is about to exit.
+// This must be called from the goroutine that is exiting the process.
+func writeExit(report *CrashReport) {
+	report.Include(ProfileGoroutines | ProfileHeap)
+	report.crash = true
+	if path, err := writeAuto("", "exit", "", report); err == nil && path != "" {
+		_ = markPending(path, "exit", report)
+	}
+}
+
+// Logger a [log.Logger] that writes a crash report before exiting when
+// one of the Fatal methods is called. See [Exit].
+type Logger struct{ *log.Logger }
+
+// NewLogger wraps l so the Fatal methods write a crash report before exiting.
+// Use [FatalWriter] to also cover the Fatal functions of the log package.
+func NewLogger(l *log.Logger) *Logger { return &Logger{Logger: l} }
+
+// Fatal is equivalent to l.Print() followed by a call to [Exit](1, ...).
+func (l *Logger) Fatal(v ...any) { l.fatal(fmt.Sprint(v...)) }
+
+// Fatalf is equivalent to l.Printf() followed by a call to [Exit](1, ...).
+func (l *Logger) Fatalf(format string, v ...any) { l.fatal(fmt.Sprintf(format, v...)) }
+
+// Fatalln is equivalent to l.Println() followed by a call to [Exit](1, ...).
+func (l *Logger) Fatalln(v ...any) { l.fatal(fmt.Sprintln(v...)) }
+
+func (l *Logger) fatal(s string) {
+	_ = l.Output(3, s)
+	exit(NewCrashReport("fatal: "+strings.TrimSuffix(s, "\n")), 1)
+}
+
+// fatalFuncs the functions of the log package that exit the process after writing the message.
+var fatalFuncs = map[string]bool{
+	"log.Fatal":             true,
+	"log.Fatalf":            true,
+	"log.Fatalln":           true,
+	"log.(*Logger).Fatal":   true,
+	"log.(*Logger).Fatalf":  true,
+	"log.(*Logger).Fatalln": true,
+}
+
+// FatalWriter returns a writer that writes to w and also writes a crash report if the
+// message was written by one of the Fatal functions of the log package, before they
+// exit the process. Unlike [NewLogger] this does not require changing the code that logs:
+//
+//	log.SetOutput(crashreport.FatalWriter(os.Stderr))
+//
+// The functions registered using [OnExit] are not called, since the log package
+// holds the lock of the logger while writing and a hook that logs would never return.
+func FatalWriter(w io.Writer) io.Writer { return &fatalWriter{w: w} }
+
+// fatalWriter the writer returned by [FatalWriter].
+type fatalWriter struct{ w io.Writer }
+
+func (f *fatalWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if calledByFatal() {
+		writeExit(NewCrashReport("fatal: " + strings.TrimSuffix(string(p), "\n")))
+	}
+	return n, err
+}
+
+// calledByFatal checks if the caller of the function calling calledByFatal was
+// called by one of the Fatal functions of the log package.
+func calledByFatal() bool {
+	var pcs [16]uintptr
+	// skip runtime.Callers, calledByFatal and its caller.
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs[:])])
+	for {
+		frame, more := frames.Next()
+		if fatalFuncs[frame.Function] {
+			return true
+		}
+		if !more {
+			return false
+		}
+	}
+}
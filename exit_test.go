@@ -0,0 +1,149 @@
+package crashreport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+)
+
+// helperEnv the environment variable that makes the test binary run one of
+// the helpers instead of the tests. Reports are written to the directory in helperDirEnv.
+const (
+	helperEnv    = "CRASHREPORT_TEST_HELPER"
+	helperDirEnv = "CRASHREPORT_TEST_DIR"
+)
+
+// helpers functions that exit the process, run in a new process by runHelper.
+var helpers = map[string]func(){
+	"exit": func() {
+		OnExit(func() { fmt.Println("hook called") })
+		Exit(3, "exit reason")
+	},
+	"logger": func() {
+		NewLogger(log.New(os.Stderr, "", 0)).Fatalf("logger %d", 1)
+	},
+	"log.Fatal": func() {
+		log.SetFlags(0)
+		log.SetOutput(FatalWriter(os.Stderr))
+		log.Fatal("std fatal")
+	},
+}
+
+func TestMain(m *testing.M) {
+	if name := os.Getenv(helperEnv); name != "" {
+		Configure(Options{Dir: os.Getenv(helperDirEnv), RateLimit: -1})
+		helpers[name]()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runHelper runs the helper with the given name in a new process.
+// It returns the directory reports were written to, the output and the exit code of the process.
+func runHelper(t *testing.T, name string) (dir, stdout string, code int) {
+	t.Helper()
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	dir = t.TempDir()
+	cmd := exec.Command(exe)
+	cmd.Env = append(os.Environ(), helperEnv+"="+name, helperDirEnv+"="+dir)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return dir, out.String(), code
+}
+
+func TestExit(t *testing.T) {
+	for _, tt := range []struct {
+		helper, reason string
+		code           int
+	}{
+		{"exit", "exit reason", 3},
+		{"logger", "fatal: logger 1", 1},
+		{"log.Fatal", "fatal: std fatal", 1},
+	} {
+		t.Run(tt.helper, func(t *testing.T) {
+			dir, stdout, code := runHelper(t, tt.helper)
+			if code != tt.code {
+				t.Errorf("expected exit code %d, got %d", tt.code, code)
+			}
+
+			files := findReports(t, dir, "exit")
+			if len(files) != 1 {
+				t.Fatalf("expected 1 report, got %v", files)
+			}
+			if r := openReport(t, files[0]); r.Reason() != tt.reason {
+				t.Errorf("got reason %q, expected %q", r.Reason(), tt.reason)
+			}
+
+			if tt.helper == "exit" && stdout != "hook called\n" {
+				t.Errorf("exit hook was not called: %q", stdout)
+			}
+
+			pending, err := PendingReports(dir)
+			if err != nil || len(pending) != 1 {
+				t.Errorf("report was not marked as pending: %v, %v", pending, err)
+			}
+		})
+	}
+}
+
+func TestFatalWriter(t *testing.T) {
+	dir := t.TempDir()
+	configure(t, Options{Dir: dir, RateLimit: -1})
+
+	var out bytes.Buffer
+	l := log.New(FatalWriter(&out), "", 0)
+	l.Print("not fatal")
+	l.Println("also not fatal")
+
+	if out.String() != "not fatal\nalso not fatal\n" {
+		t.Errorf("output was not written: %q", out.String())
+	}
+	if files := findReports(t, dir, "exit"); len(files) != 0 {
+		t.Errorf("a report was written for a message that is not fatal: %v", files)
+	}
+}
+
+func TestOnExit(t *testing.T) {
+	var called []int
+	unregister1 := OnExit(func() { called = append(called, 1) })
+	unregister2 := OnExit(func() { panic("hook failed") })
+	unregister3 := OnExit(func() { called = append(called, 3) })
+	defer unregister1()
+	defer unregister3()
+
+	unregister2()
+	unregister2()
+
+	runExitHooks()
+	if !reflect.DeepEqual(called, []int{3, 1}) {
+		t.Errorf("hooks were called in the wrong order: %v", called)
+	}
+
+	// panicking hooks do not prevent other hooks from being called.
+	unregister := OnExit(func() { panic("hook failed") })
+	defer unregister()
+	called = nil
+	runExitHooks()
+	if len(called) != 2 {
+		t.Errorf("hooks were not called after a hook panicked: %v", called)
+	}
+}
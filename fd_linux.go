@@ -0,0 +1,20 @@
+package crashreport
+
+import "os"
+
+// openFDs returns the number of open file descriptors of this process.
+func openFDs() (int, bool) {
+	f, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return 0, false
+	}
+
+	// the directory opened above is included in the listing.
+	return len(names) - 1, true
+}
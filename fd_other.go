@@ -0,0 +1,7 @@
+//go:build !linux
+
+package crashreport
+
+// openFDs returns the number of open file descriptors of this process.
+// This is not supported on this platform.
+func openFDs() (int, bool) { return 0, false }
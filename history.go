@@ -0,0 +1,147 @@
+package crashreport
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/yehan2002/crashreport/internal"
+)
+
+// historyFile the name of the file used to keep track of recent crashes.
+const historyFile = ".crashreport-history.json"
+
+// maxHistory the maximum number of crashes kept in the history file.
+const maxHistory = 64
+
+// maxReportHistory the maximum number of crashes included in a report.
+const maxReportHistory = 10
+
+// historyMux prevents concurrent updates to the history file from this process.
+var historyMux sync.Mutex
+
+// CrashLoop the state of the crash history. See [CrashLoopState].
+type CrashLoop struct {
+	// Count the number of crashes within Window.
+	Count int
+	// Window the duration crashes are counted over. See [Options.CrashLoopWindow].
+	Window time.Duration
+	// LastCrash the time of the last crash. This is zero if there are no recorded crashes.
+	LastCrash time.Time
+	// LastFingerprint the fingerprint of the last crash.
+	LastFingerprint string
+	// LastKind the kind of the last crash, either "panic" or "exit".
+	LastKind string
+}
+
+// Looping returns true if the program crashed at least n times within [CrashLoop.Window].
+func (c CrashLoop) Looping(n int) bool { return c.Count >= n }
+
+// Backoff returns the duration the program should wait before starting normally.
+// The duration starts at base after the first crash and doubles for every further
+// crash within [CrashLoop.Window], up to max. Zero is returned if there were no crashes.
+func (c CrashLoop) Backoff(base, max time.Duration) time.Duration {
+	if c.Count == 0 {
+		return 0
+	}
+
+	d := base
+	for i := 1; i < c.Count && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// CrashLoopState returns the crashes recorded in [Options.Dir] by previous runs of the program.
+// A crash is recorded every time a report is written by [Recover] or [Exit],
+// even if the report is suppressed by the rate limit.
+//
+// This can be used when the program starts to detect that it is being restarted in a loop,
+// for example to enter a safe mode or to wait before starting:
+//
+//	time.Sleep(crashreport.CrashLoopState().Backoff(time.Second, time.Minute))
+func CrashLoopState() CrashLoop {
+	o := currentOptions()
+	state := CrashLoop{Window: o.CrashLoopWindow}
+	if o.CrashLoopWindow < 0 {
+		return state
+	}
+
+	historyMux.Lock()
+	crashes := readHistory(o.Dir)
+	historyMux.Unlock()
+
+	h := summarizeHistory(crashes, o.CrashLoopWindow, time.Now())
+	state.Count = h.Count
+	if last := h.Last(); last != nil {
+		state.LastCrash, state.LastFingerprint, state.LastKind = last.Time, last.Fingerprint, last.Kind
+	}
+	return state
+}
+
+// crashHistory returns a summary of the crash history in dir to be included in a report.
+// If crash is true, a crash with the given kind and fingerprint is recorded first.
+// nil is returned if window is negative or there are no recorded crashes.
+// Errors reading or writing the history file are ignored so that a broken history
+// file never prevents reports from being written.
+func crashHistory(dir, kind, fingerprint string, crash bool, window time.Duration) *internal.History {
+	if window < 0 {
+		return nil
+	}
+
+	historyMux.Lock()
+	defer historyMux.Unlock()
+
+	now := time.Now()
+	crashes := readHistory(dir)
+	if crash {
+		crashes = append(crashes, &internal.Crash{Time: now, Kind: kind, Fingerprint: fingerprint, PID: os.Getpid()})
+		if len(crashes) > maxHistory {
+			crashes = crashes[len(crashes)-maxHistory:]
+		}
+		_ = writeState(filepath.Join(dir, historyFile), crashes)
+	}
+
+	if len(crashes) == 0 {
+		return nil
+	}
+	return summarizeHistory(crashes, window, now)
+}
+
+// readHistory reads the crashes recorded in dir.
+func readHistory(dir string) []*internal.Crash {
+	var crashes []*internal.Crash
+	if buf, err := os.ReadFile(filepath.Join(dir, historyFile)); err == nil {
+		_ = json.Unmarshal(buf, &crashes)
+	}
+
+	// ignore invalid entries written by a broken history file.
+	valid := crashes[:0]
+	for _, c := range crashes {
+		if c != nil {
+			valid = append(valid, c)
+		}
+	}
+	return valid
+}
+
+// summarizeHistory counts the crashes within window before now and keeps the most recent crashes.
+func summarizeHistory(crashes []*internal.Crash, window time.Duration, now time.Time) *internal.History {
+	h := &internal.History{Window: window}
+	for _, c := range crashes {
+		if now.Sub(c.Time) <= window {
+			h.Count++
+		}
+	}
+
+	if len(crashes) > maxReportHistory {
+		crashes = crashes[len(crashes)-maxReportHistory:]
+	}
+	h.Crashes = crashes
+	return h
+}
@@ -0,0 +1,141 @@
+package crashreport
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yehan2002/crashreport/internal"
+)
+
+func TestBackoff(t *testing.T) {
+	for count, expected := range map[int]time.Duration{
+		0: 0, 1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: time.Minute, 1000: time.Minute,
+	} {
+		if d := (CrashLoop{Count: count}).Backoff(time.Second, time.Minute); d != expected {
+			t.Errorf("%d crashes: got %s, expected %s", count, d, expected)
+		}
+	}
+
+	if (CrashLoop{Count: 2}).Looping(3) || !(CrashLoop{Count: 3}).Looping(3) {
+		t.Error("unexpected result from Looping")
+	}
+}
+
+func TestCrashHistory(t *testing.T) {
+	dir := t.TempDir()
+	configure(t, Options{Dir: dir, CrashLoopWindow: time.Hour})
+
+	if state := CrashLoopState(); state.Count != 0 || !state.LastCrash.IsZero() {
+		t.Errorf("unexpected state without crashes %+v", state)
+	}
+
+	// reports that are not crashes are not recorded.
+	if h := crashHistory(dir, "trigger", "t", false, time.Hour); h != nil {
+		t.Errorf("history was created without crashes: %+v", h)
+	}
+
+	crashHistory(dir, "panic", "a", true, time.Hour)
+	h := crashHistory(dir, "exit", "b", true, time.Hour)
+	if h == nil || h.Count != 2 || len(h.Crashes) != 2 {
+		t.Fatalf("unexpected history %+v", h)
+	}
+
+	state := CrashLoopState()
+	if state.Count != 2 || state.LastKind != "exit" || state.LastFingerprint != "b" || state.Window != time.Hour {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	// a negative window disables the history.
+	configure(t, Options{Dir: dir, CrashLoopWindow: -1})
+	if state = CrashLoopState(); state.Count != 0 {
+		t.Errorf("history was used with a negative window: %+v", state)
+	}
+	if h = crashHistory(dir, "panic", "c", true, -1); h != nil {
+		t.Errorf("crash was recorded with a negative window: %+v", h)
+	}
+}
+
+func TestCrashHistoryLimits(t *testing.T) {
+	dir := t.TempDir()
+
+	old := time.Now().Add(-2 * time.Hour)
+	crashes := make([]*internal.Crash, maxHistory)
+	for i := range crashes {
+		crashes[i] = &internal.Crash{Time: old, Kind: "panic"}
+	}
+	if err := writeState(filepath.Join(dir, historyFile), crashes); err != nil {
+		t.Fatal(err)
+	}
+
+	h := crashHistory(dir, "panic", "new", true, time.Hour)
+	// only the new crash is within the window.
+	if h.Count != 1 {
+		t.Errorf("expected 1 crash within the window, got %d", h.Count)
+	}
+	if len(h.Crashes) != maxReportHistory || h.Crashes[len(h.Crashes)-1].Fingerprint != "new" {
+		t.Errorf("unexpected crashes in the report %d", len(h.Crashes))
+	}
+	if n := len(readHistory(dir)); n != maxHistory {
+		t.Errorf("history file contains %d crashes", n)
+	}
+}
+
+func TestCrashHistoryBroken(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, historyFile), []byte("[null, {"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if h := crashHistory(dir, "panic", "a", true, time.Hour); h == nil || h.Count != 1 {
+		t.Errorf("broken history file was not replaced: %+v", h)
+	}
+}
+
+func TestReportIncludesHistory(t *testing.T) {
+	dir := t.TempDir()
+	configure(t, Options{Dir: dir, RateLimit: -1})
+
+	func() {
+		defer func() { _ = recover() }()
+		defer Recover()
+		panic("first")
+	}()
+
+	files := findReports(t, dir, "panic")
+	if len(files) != 1 {
+		t.Fatalf("expected 1 report, got %v", files)
+	}
+	h := openReport(t, files[0]).History()
+	if h == nil || h.Count != 1 || h.Last().Kind != "panic" {
+		t.Errorf("history was not included: %+v", h)
+	}
+}
+
+func TestWrittenReportIncludesHistory(t *testing.T) {
+	dir := t.TempDir()
+	configure(t, Options{Dir: dir, CrashLoopWindow: time.Hour})
+
+	path := filepath.Join(t.TempDir(), "report.zip")
+	if err := NewCrashReport("none").WriteTo(path); err != nil {
+		t.Fatal(err)
+	}
+	if h := openReport(t, path).History(); h != nil {
+		t.Errorf("history was included without crashes: %+v", h)
+	}
+
+	crashHistory(dir, "panic", "a", true, time.Hour)
+
+	// reports that are written manually include the history but are not recorded.
+	if err := NewCrashReport("manual").WriteTo(path); err != nil {
+		t.Fatal(err)
+	}
+	h := openReport(t, path).History()
+	if h == nil || h.Count != 1 || h.Last().Kind != "panic" {
+		t.Errorf("history was not included: %+v", h)
+	}
+	if state := CrashLoopState(); state.Count != 1 {
+		t.Errorf("the report was recorded as a crash: %+v", state)
+	}
+}
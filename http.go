@@ -0,0 +1,181 @@
+package crashreport
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// redactedHeaders headers that are always redacted.
+var redactedHeaders = []string{
+	"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token", "X-Csrf-Token",
+}
+
+// HTTPOptions configures [HTTPMiddleware].
+type HTTPOptions struct {
+	// Route returns the route that matched the request, if it is not nil.
+	// This is useful for routers that use patterns like "/users/{id}".
+	Route func(*http.Request) string
+	// RedactHeaders extra headers whose values are not included in the report.
+	// Authorization, cookie and common token headers are always redacted.
+	RedactHeaders []string
+	// MaxBody the maximum number of bytes of the request body included in the report.
+	// Only the part of the body that was read by the handler before it panicked is included.
+	// Zero excludes the body.
+	MaxBody int
+	// IDHeader the response header that contains the id of the written report.
+	// Defaults to "X-Crash-Report-Id".
+	IDHeader string
+	// Dir the directory reports are written to. Defaults to [Options.Dir].
+	Dir string
+	// OnReport is called after a report was written, if it is not nil.
+	OnReport func(r *http.Request, path string, err error)
+}
+
+// HTTPMiddleware returns a handler that recovers panics in next and writes a crash report.
+// The report includes the request method, url, route, remote address and headers,
+// the values and pprof labels of the request context, and optionally the start of
+// the request body that was read by the handler. If nothing was written to the response yet, the middleware
+// responds with 500 Internal Server Error and the id of the report.
+//
+// Panics with [http.ErrAbortHandler] are not reported.
+func HTTPMiddleware(next http.Handler, opts HTTPOptions) http.Handler {
+	if opts.IDHeader == "" {
+		opts.IDHeader = "X-Crash-Report-Id"
+	}
+
+	redact := map[string]bool{}
+	for _, h := range append(redactedHeaders, opts.RedactHeaders...) {
+		redact[http.CanonicalHeaderKey(h)] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &responseWriter{ResponseWriter: w}
+
+		var body *bodyRecorder
+		if opts.MaxBody > 0 && r.Body != nil && r.Body != http.NoBody {
+			body = &bodyRecorder{ReadCloser: r.Body, max: opts.MaxBody}
+			r.Body = body
+		}
+
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(v)
+			}
+
+			report := requestReport(r, &opts, redact)
+			if body != nil {
+				report.IncludeBytes("request-body", body.buf.Bytes())
+			}
+
+			path, err := writePanic(opts.Dir, report, v)
+			if opts.OnReport != nil {
+				opts.OnReport(r, path, err)
+			}
+
+			if rw.wroteHeader {
+				return
+			}
+			if err == nil && path != "" {
+				w.Header().Set(opts.IDHeader, report.ID())
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// requestReport creates a crash report containing information about the request.
+func requestReport(r *http.Request, opts *HTTPOptions, redact map[string]bool) *CrashReport {
+	report := FromContext(r.Context()).
+		Set("http.method", r.Method).
+		Set("http.url", r.URL.String()).
+		Set("http.proto", r.Proto).
+		Set("http.host", r.Host).
+		Set("http.remote_addr", r.RemoteAddr)
+
+	if opts.Route != nil {
+		report.Set("http.route", opts.Route(r))
+	}
+
+	keys := make([]string, 0, len(r.Header))
+	for k := range r.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		value := strings.Join(r.Header[k], ", ")
+		if redact[http.CanonicalHeaderKey(k)] {
+			value = "[redacted]"
+		}
+		report.Set("http.header."+k, value)
+	}
+
+	return report
+}
+
+// responseWriter keeps track of whether the response header was written.
+type responseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("crashreport: response writer does not implement http.Hijacker")
+	}
+	w.wroteHeader = true
+	return h.Hijack()
+}
+
+// Unwrap returns the wrapped response writer.
+func (w *responseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// bodyRecorder keeps a copy of the first max bytes read from the request body.
+// Only bytes that were already read by the handler are recorded, the body is
+// never read after the handler panicked.
+type bodyRecorder struct {
+	io.ReadCloser
+	buf bytes.Buffer
+	max int
+}
+
+func (b *bodyRecorder) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if remaining := b.max - b.buf.Len(); remaining > 0 && n > 0 {
+		if remaining > n {
+			remaining = n
+		}
+		b.buf.Write(p[:remaining])
+	}
+	return n, err
+}
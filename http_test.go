@@ -0,0 +1,160 @@
+package crashreport
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serve serves req using a handler that calls fn and then panics.
+// It returns the response and the path of the written report.
+func serve(t *testing.T, req *http.Request, opts HTTPOptions, fn func(w http.ResponseWriter, r *http.Request)) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+
+	var path string
+	opts.Dir = t.TempDir()
+	opts.OnReport = func(_ *http.Request, p string, err error) {
+		if err != nil {
+			t.Errorf("failed to write report: %v", err)
+		}
+		path = p
+	}
+
+	h := HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fn(w, r)
+		panic("handler failed")
+	}), opts)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w, path
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	configure(t, Options{RateLimit: -1})
+
+	req := httptest.NewRequest(http.MethodPost, "/users/1?q=x", strings.NewReader("hello world"))
+	req.Header.Set("Authorization", "secret")
+	req.Header.Set("X-Session", "secret")
+	req.Header.Set("User-Agent", "test")
+
+	opts := HTTPOptions{
+		MaxBody:       100,
+		RedactHeaders: []string{"x-session"},
+		Route:         func(*http.Request) string { return "/users/{id}" },
+	}
+	w, path := serve(t, req, opts, func(_ http.ResponseWriter, r *http.Request) {
+		// only part of the body is read by the handler.
+		buf := make([]byte, 5)
+		_, _ = io.ReadFull(r.Body, buf)
+	})
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", w.Code)
+	}
+	if path == "" {
+		t.Fatal("report was not written")
+	}
+
+	r := openReport(t, path)
+	if id := w.Header().Get("X-Crash-Report-Id"); id == "" || id != r.ID() {
+		t.Errorf("report id header %q does not match report %q", id, r.ID())
+	}
+	if r.Reason() != "panic: handler failed" {
+		t.Errorf("unexpected reason %q", r.Reason())
+	}
+
+	m := r.Metadata()
+	expected := map[string]string{
+		"http.method":               http.MethodPost,
+		"http.url":                  "/users/1?q=x",
+		"http.route":                "/users/{id}",
+		"http.header.Authorization": "[redacted]",
+		"http.header.X-Session":     "[redacted]",
+		"http.header.User-Agent":    "test",
+	}
+	for k, v := range expected {
+		if m[k] != v {
+			t.Errorf("%s: got %q, expected %q", k, m[k], v)
+		}
+	}
+
+	attachments := r.Attachments()
+	if len(attachments) != 1 || attachments[0].Name() != "request-body" {
+		t.Fatalf("unexpected attachments %v", attachments)
+	}
+	if body, err := attachments[0].Bytes(); err != nil || string(body) != "hello" {
+		t.Errorf("expected only the consumed body, got %q, %v", body, err)
+	}
+}
+
+func TestHTTPMiddlewareUnreadBody(t *testing.T) {
+	configure(t, Options{RateLimit: -1})
+
+	body := &countingReader{r: strings.NewReader("unread")}
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+
+	_, path := serve(t, req, HTTPOptions{MaxBody: 100}, func(http.ResponseWriter, *http.Request) {})
+	if body.reads != 0 {
+		t.Errorf("body was read %d times after the handler panicked", body.reads)
+	}
+
+	r := openReport(t, path)
+	for _, a := range r.Attachments() {
+		if b, _ := a.Bytes(); len(b) != 0 {
+			t.Errorf("unread body was included: %q", b)
+		}
+	}
+}
+
+func TestHTTPMiddlewareHeaderWritten(t *testing.T) {
+	configure(t, Options{RateLimit: -1})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w, path := serve(t, req, HTTPOptions{}, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	if path == "" {
+		t.Error("report was not written")
+	}
+	if w.Code != http.StatusAccepted {
+		t.Errorf("status was overwritten: %d", w.Code)
+	}
+	if id := w.Header().Get("X-Crash-Report-Id"); id != "" {
+		t.Errorf("id header was set after the header was written: %q", id)
+	}
+}
+
+func TestHTTPMiddlewareAbortHandler(t *testing.T) {
+	dir := t.TempDir()
+	called := false
+	h := HTTPMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}), HTTPOptions{Dir: dir, OnReport: func(*http.Request, string, error) { called = true }})
+
+	defer func() {
+		v := recover()
+		if err, ok := v.(error); !ok || !errors.Is(err, http.ErrAbortHandler) {
+			t.Errorf("expected http.ErrAbortHandler to be re-panicked, got %v", v)
+		}
+		if called || len(findReports(t, dir, "panic")) != 0 {
+			t.Error("a report was written for http.ErrAbortHandler")
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+// countingReader counts the calls to Read.
+type countingReader struct {
+	r     io.Reader
+	reads int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	c.reads++
+	return c.r.Read(p)
+}
@@ -0,0 +1,25 @@
+package crashreport
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/yehan2002/crashreport/internal"
+)
+
+// ImportTraceback converts the traceback printed by a Go program that panicked
+// or encountered a fatal error into a crash report and writes it to w.
+// Any text before the traceback, such as other log output, is ignored.
+func ImportTraceback(r io.Reader, w io.Writer) error {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("unable to read traceback: %w", err)
+	}
+
+	report, err := internal.ParseTraceback(string(buf))
+	if err != nil {
+		return err
+	}
+
+	return report.Write(w)
+}
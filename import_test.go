@@ -0,0 +1,31 @@
+package crashreport
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestImportTraceback(t *testing.T) {
+	text := "log output\npanic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/src/main.go:5 +0x25\nexit status 2\n"
+
+	var buf bytes.Buffer
+	if err := ImportTraceback(strings.NewReader(text), &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	r := readReport(t, buf.Bytes())
+	if r.Reason() != "panic: boom" {
+		t.Errorf("unexpected reason %q", r.Reason())
+	}
+	if !strings.Contains(r.Stack(), "main.main()") {
+		t.Errorf("stack was not imported:\n%s", r.Stack())
+	}
+	if r.GoroutineID() != 1 {
+		t.Errorf("unexpected goroutine id %d", r.GoroutineID())
+	}
+
+	if err := ImportTraceback(strings.NewReader("no traceback"), &bytes.Buffer{}); err == nil {
+		t.Error("expected an error for input without a traceback")
+	}
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile writes a file using write without leaving a partially written file behind.
+// The data is written to a temporary file in the same directory, which is synced and then
+// renamed to filename. The temporary file is removed if an error occurs, so filename is
+// either unchanged or contains everything written by write.
+// If syncDir is true, the directory is also synced after the rename so the file is not lost on power loss.
+func WriteFile(filename string, syncDir bool, write func(w io.Writer) error) (err error) {
+	dir := filepath.Dir(filename)
+
+	f, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	renamed := false
+	defer func() {
+		if !renamed {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if err = f.Chmod(0o644); err != nil {
+		return err
+	}
+
+	if err = write(f); err != nil {
+		return err
+	}
+
+	if err = f.Sync(); err != nil {
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Rename(f.Name(), filename); err != nil {
+		return err
+	}
+	renamed = true
+
+	if syncDir {
+		return SyncDir(dir)
+	}
+	return nil
+}
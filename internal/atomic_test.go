@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dirEntries returns the names of the files in dir.
+func dirEntries(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.crash")
+
+	for _, syncDir := range []bool{false, true} {
+		err := WriteFile(path, syncDir, func(w io.Writer) error {
+			_, err := io.WriteString(w, "report")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if data, err := os.ReadFile(path); err != nil || string(data) != "report" {
+			t.Errorf("got %q, %v", data, err)
+		}
+		if names := dirEntries(t, dir); len(names) != 1 {
+			t.Errorf("temporary files were left behind: %v", names)
+		}
+	}
+}
+
+func TestWriteFileError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.crash")
+	if err := os.WriteFile(path, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	errWrite := errors.New("write failed")
+	err := WriteFile(path, false, func(w io.Writer) error {
+		_, _ = io.WriteString(w, "partial")
+		return errWrite
+	})
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "old" {
+		t.Errorf("existing file was modified: %q", data)
+	}
+	if names := dirEntries(t, dir); len(names) != 1 {
+		t.Errorf("temporary files were left behind: %v", names)
+	}
+
+	if err = WriteFile(filepath.Join(dir, "missing", "report.crash"), false, func(io.Writer) error { return nil }); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"runtime/pprof"
+	"sync"
+
+	"github.com/google/pprof/profile"
+)
+
+// baselineProfiles the profiles recorded by [TakeBaseline].
+var baselineProfiles = [...]string{"heap", "allocs", "block", "mutex"}
+
+// deltaSuffix the suffix added to the name of delta profiles.
+const deltaSuffix = ".delta"
+
+var (
+	baselineMux sync.Mutex
+	baseline    map[string]*profile.Profile
+)
+
+// TakeBaseline records the heap, allocs, block and mutex profiles.
+// Delta profiles are computed against the most recent baseline.
+func TakeBaseline() error {
+	b := map[string]*profile.Profile{}
+	for _, name := range baselineProfiles {
+		var buf bytes.Buffer
+		if err := pprof.Lookup(name).WriteTo(&buf, 0); err != nil {
+			return fmt.Errorf("unable to write profile %s: %w", name, err)
+		}
+
+		p, err := profile.ParseData(buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("unable to parse profile %s: %w", name, err)
+		}
+		b[name] = p
+	}
+
+	baselineMux.Lock()
+	baseline = b
+	baselineMux.Unlock()
+	return nil
+}
+
+// isBaselineProfile checks if the baseline of the profile with the given name is recorded by [TakeBaseline].
+func isBaselineProfile(name string) bool {
+	for _, p := range baselineProfiles {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// deltaProfile computes the difference between current and the baseline of the given profile.
+// nil is returned if no baseline exists for the profile.
+func deltaProfile(name string, current []byte) (*Profile, error) {
+	baselineMux.Lock()
+	base := baseline[name]
+	baselineMux.Unlock()
+
+	if base == nil {
+		return nil, nil
+	}
+
+	cur, err := profile.ParseData(current)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse profile %s: %w", name, err)
+	}
+
+	// the baseline is shared between reports, scale a copy of it.
+	base = base.Copy()
+	base.Scale(-1)
+
+	delta, err := profile.Merge([]*profile.Profile{cur, base})
+	if err != nil {
+		return nil, fmt.Errorf("unable to compute delta profile %s: %w", name, err)
+	}
+
+	delta.TimeNanos = cur.TimeNanos
+	delta.DurationNanos = cur.TimeNanos - base.TimeNanos
+	if delta.DurationNanos < 0 {
+		delta.DurationNanos = 0
+	}
+
+	var buf bytes.Buffer
+	if err = delta.Write(&buf); err != nil {
+		return nil, fmt.Errorf("unable to write delta profile %s: %w", name, err)
+	}
+
+	return NewProfile(name+deltaSuffix, buf.Bytes()), nil
+}
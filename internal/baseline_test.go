@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+// allocSink keeps allocations made by tests reachable.
+var allocSink [][]byte
+
+// resetBaseline removes the baseline after the test.
+func resetBaseline(t *testing.T) {
+	t.Cleanup(func() {
+		baselineMux.Lock()
+		baseline = nil
+		baselineMux.Unlock()
+	})
+}
+
+// hasProfile checks if the report contains a profile with the given file name.
+func hasProfile(c *CrashReport, name string) bool {
+	for _, p := range c.Profiles {
+		if p.FileName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDeltaWithoutBaseline(t *testing.T) {
+	resetBaseline(t)
+	baselineMux.Lock()
+	baseline = nil
+	baselineMux.Unlock()
+
+	c := Config{Profiles: map[string]struct{}{}, Delta: true}
+	ProfileAllocs.Add(&c)
+
+	if report := roundTrip(t, c); hasProfile(report, "allocs"+deltaSuffix) {
+		t.Error("delta profile was included without a baseline")
+	}
+}
+
+func TestDeltaProfile(t *testing.T) {
+	resetBaseline(t)
+	if err := TakeBaseline(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1024; i++ {
+		allocSink = append(allocSink, make([]byte, 16<<10))
+	}
+	allocSink = nil
+	// the allocs profile is only updated by the garbage collector.
+	runtime.GC()
+	runtime.GC()
+
+	c := Config{Profiles: map[string]struct{}{}, Delta: true}
+	(ProfileAllocs | ProfileGoroutines).Add(&c)
+	report := roundTrip(t, c)
+
+	if hasProfile(report, "goroutine"+deltaSuffix) {
+		t.Error("delta profile was included for a profile without a baseline")
+	}
+
+	delta := findProfile(t, report, "allocs"+deltaSuffix)
+	if delta.Name() != "Allocs (delta)" {
+		t.Errorf("display name %q", delta.Name())
+	}
+
+	prof, err := delta.Profile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prof.DurationNanos <= 0 {
+		t.Errorf("duration %d, expected the time since the baseline", prof.DurationNanos)
+	}
+
+	if allocated := sampleSum(prof, "alloc_space"); allocated <= 0 {
+		t.Errorf("delta profile allocated %d bytes, expected the allocations since the baseline", allocated)
+	}
+	if allocated, total := sampleSum(prof, "alloc_space"), sampleSum(mustParse(t, findProfile(t, report, "allocs")), "alloc_space"); allocated >= total {
+		t.Errorf("delta profile allocated %d bytes, expected less than the %d bytes since the program started", allocated, total)
+	}
+}
+
+// sampleSum returns the sum of the values of the given sample type.
+func sampleSum(p *profile.Profile, sampleType string) int64 {
+	index := -1
+	for i, st := range p.SampleType {
+		if st.Type == sampleType {
+			index = i
+		}
+	}
+	if index < 0 {
+		return 0
+	}
+
+	var sum int64
+	for _, s := range p.Sample {
+		sum += s.Value[index]
+	}
+	return sum
+}
+
+func mustParse(t *testing.T, p *Profile) *profile.Profile {
+	t.Helper()
+	prof, err := p.Profile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prof
+}
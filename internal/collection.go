@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Stages of creating a crash report.
+const (
+	StageCollect = "collect"
+	StageWrite   = "write"
+	// StageRead is used for entries that could not be read from a crash report file.
+	StageRead = "read"
+	// StageConfig is used for problems with the configuration of the report, like unknown profiles.
+	StageConfig = "config"
+)
+
+var (
+	// errTimedOut is returned by [Collection.runAsync] if a section did not finish in time.
+	errTimedOut = errors.New("timed out")
+	// errSkipped is returned if a section was not started because the deadline was exceeded.
+	errSkipped = errors.New("skipped")
+)
+
+// Section the result of collecting or writing a single part of a crash report.
+type Section struct {
+	// Name the name of the section.
+	Name string
+	// Stage the stage the section belongs to. One of [StageCollect], [StageWrite], [StageRead] or [StageConfig].
+	Stage string
+	// Error the error that occurred, if any.
+	Error string `json:",omitempty"`
+	// Duration the amount of time spent on the section.
+	Duration time.Duration
+	// TimedOut is true if the section did not finish before the deadline.
+	TimedOut bool `json:",omitempty"`
+}
+
+// Collection contains the result of collecting and writing every section of a crash report.
+type Collection struct {
+	Sections []*Section
+}
+
+// Problems returns all sections that failed.
+func (c *Collection) Problems() (problems []*Section) {
+	if c == nil {
+		return nil
+	}
+
+	for _, s := range c.Sections {
+		if s.Error != "" {
+			problems = append(problems, s)
+		}
+	}
+	return
+}
+
+// clone returns a copy of c.
+func (c *Collection) clone() *Collection {
+	if c == nil {
+		return &Collection{}
+	}
+	return &Collection{Sections: append([]*Section(nil), c.Sections...)}
+}
+
+// run runs fn and records the result as a section.
+// If ctx is already done, fn is not run and the section is marked as timed out.
+// Panics in fn are recovered and recorded as errors.
+func (c *Collection) run(ctx context.Context, stage, name string, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return c.add(stage, name, 0, true, fmt.Errorf("%w: %v", errSkipped, err))
+	}
+
+	start := time.Now()
+	err := call(fn)
+	timedOut := errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+	return c.add(stage, name, time.Since(start), timedOut, err)
+}
+
+// runAsync runs fn in a new goroutine and records the result as a section.
+// If fn does not return before ctx is done or timeout expires, fn is abandoned and
+// the section is marked as timed out. Since fn may still be running after runAsync
+// returns, fn must only modify state that is not read unless runAsync returns nil.
+func (c *Collection) runAsync(ctx context.Context, timeout time.Duration, stage, name string, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return c.add(stage, name, 0, true, fmt.Errorf("%w: %v", errSkipped, err))
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- call(fn) }()
+
+	select {
+	case err := <-done:
+		return c.add(stage, name, time.Since(start), false, err)
+	case <-ctx.Done():
+		return c.add(stage, name, time.Since(start), true, fmt.Errorf("%w: %v", errTimedOut, ctx.Err()))
+	}
+}
+
+// add records a section.
+func (c *Collection) add(stage, name string, d time.Duration, timedOut bool, err error) error {
+	s := &Section{Name: name, Stage: stage, Duration: d, TimedOut: timedOut}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	c.Sections = append(c.Sections, s)
+	return err
+}
+
+// call calls fn and converts panics to errors.
+func call(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return fn()
+}
+
+// ctxReader a reader that stops reading once ctx is done.
+// Each read is performed in a new goroutine so reads that block
+// forever (for example on a unresponsive network filesystem) can be abandoned.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+
+	// the goroutine must not write to p after Read returns.
+	buf := make([]byte, len(p))
+	done := make(chan result, 1)
+	go func() {
+		n, err := r.r.Read(buf)
+		done <- result{n, err}
+	}()
+
+	select {
+	case res := <-done:
+		return copy(p, buf[:res.n]), res.err
+	case <-r.ctx.Done():
+		return 0, r.ctx.Err()
+	}
+}
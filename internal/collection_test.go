@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// findSection returns the section with the given stage and name.
+func findSection(c *Collection, stage, name string) *Section {
+	for _, s := range c.Sections {
+		if s.Stage == stage && s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestCollectionRun(t *testing.T) {
+	c := &Collection{}
+	ctx := context.Background()
+
+	if err := c.run(ctx, StageWrite, "ok", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.run(ctx, StageWrite, "error", func() error { return errors.New("failed") }); err == nil {
+		t.Fatal("error was not returned")
+	}
+	if err := c.run(ctx, StageWrite, "panic", func() error { panic("boom") }); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("panic was not converted to an error: %v", err)
+	}
+
+	problems := c.Problems()
+	if len(problems) != 2 || problems[0].Name != "error" || problems[1].Name != "panic" {
+		t.Fatalf("unexpected problems: %+v", problems)
+	}
+	if len(c.Sections) != 3 {
+		t.Errorf("got %d sections, expected 3", len(c.Sections))
+	}
+}
+
+func TestBestEffortReport(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.log")
+	c := Config{
+		Reason:   []string{"best effort"},
+		Profiles: map[string]struct{}{"goroutine": {}, "does-not-exist": {}},
+		Files:    []string{missing},
+	}
+
+	report := roundTrip(t, c)
+
+	if report.Reason != "best effort" {
+		t.Errorf("reason %q", report.Reason)
+	}
+	if !hasProfile(report, "goroutine") {
+		t.Error("goroutine profile was not included")
+	}
+	if report.Stack == "" || report.Memstats == nil || report.SysInfo == nil {
+		t.Error("other sections were not included")
+	}
+
+	if s := findSection(report.Collection, StageConfig, "profiles/does-not-exist"); s == nil || s.Error == "" {
+		t.Errorf("missing profile was not recorded: %+v", s)
+	}
+	if s := findSection(report.Collection, StageWrite, "include/missing.log"); s == nil || s.Error == "" {
+		t.Errorf("missing file was not recorded: %+v", s)
+	}
+	if s := findSection(report.Collection, StageWrite, "reason"); s == nil || s.Error != "" || s.Duration < 0 {
+		t.Errorf("successful section was not recorded: %+v", s)
+	}
+}
+
+func TestCollectionDurations(t *testing.T) {
+	c := &Collection{}
+	_ = c.run(context.Background(), StageCollect, "slow", func() error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	if s := c.Sections[0]; s.Duration < 10*time.Millisecond {
+		t.Errorf("duration %s, expected at least 10ms", s.Duration)
+	}
+}
+
+func TestRunAsyncTimeout(t *testing.T) {
+	c := &Collection{}
+	block := make(chan struct{})
+	defer close(block)
+
+	err := c.runAsync(context.Background(), 10*time.Millisecond, StageCollect, "blocked", func() error {
+		<-block
+		return nil
+	})
+	if !errors.Is(err, errTimedOut) {
+		t.Fatalf("expected errTimedOut, got %v", err)
+	}
+	if s := c.Sections[0]; !s.TimedOut || s.Error == "" {
+		t.Errorf("section was not marked as timed out: %+v", s)
+	}
+}
+
+func TestRunSkippedAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	c := &Collection{}
+	called := false
+	fn := func() error { called = true; return nil }
+
+	if err := c.run(ctx, StageWrite, "run", fn); !errors.Is(err, errSkipped) {
+		t.Errorf("run: expected errSkipped, got %v", err)
+	}
+	if err := c.runAsync(ctx, 0, StageCollect, "async", fn); !errors.Is(err, errSkipped) {
+		t.Errorf("runAsync: expected errSkipped, got %v", err)
+	}
+	if called {
+		t.Error("fn was called after ctx was done")
+	}
+	for _, s := range c.Sections {
+		if !s.TimedOut {
+			t.Errorf("section %s was not marked as timed out", s.Name)
+		}
+	}
+}
+
+func TestCtxReader(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// the pipe is never written to, so the read blocks until ctx is done.
+	_, err := io.ReadAll(&ctxReader{ctx: ctx, r: pr})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	buf, err := io.ReadAll(&ctxReader{ctx: context.Background(), r: strings.NewReader("data")})
+	if err != nil || string(buf) != "data" {
+		t.Errorf("got %q, %v", buf, err)
+	}
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"runtime"
+	"runtime/pprof"
+	"sync/atomic"
+)
+
+var (
+	// blockProfileRate the last rate passed to [SetBlockProfileRate].
+	// The runtime does not provide a way to read the block profile rate.
+	blockProfileRate atomic.Int64
+	// blockProfileRateKnown is true if [SetBlockProfileRate] was called.
+	// The rate is unknown if the program only calls [runtime.SetBlockProfileRate].
+	blockProfileRateKnown atomic.Bool
+)
+
+// SetBlockProfileRate calls [runtime.SetBlockProfileRate] and records the rate.
+func SetBlockProfileRate(rate int) {
+	runtime.SetBlockProfileRate(rate)
+	blockProfileRate.Store(int64(rate))
+	blockProfileRateKnown.Store(true)
+}
+
+// contentionWarning returns a warning if the given profile is empty because
+// profiling is disabled.
+func contentionWarning(prof *pprof.Profile) string {
+	return profileWarning(prof.Name(), prof.Count())
+}
+
+// profileWarning returns a warning if the profile with the given name and number of
+// records is empty because profiling is disabled.
+func profileWarning(name string, count int) string {
+	if count != 0 {
+		return ""
+	}
+
+	switch name {
+	case "block":
+		if !blockProfileRateKnown.Load() {
+			return "The block profile is empty. The block profile rate is unknown, so block profiling may be disabled. " +
+				"Call runtime.SetBlockProfileRate or crashreport.EnableContentionProfiling to enable it."
+		}
+		if blockProfileRate.Load() <= 0 {
+			return "Block profiling is disabled. " +
+				"Call runtime.SetBlockProfileRate or crashreport.EnableContentionProfiling to enable it."
+		}
+	case "mutex":
+		if runtime.SetMutexProfileFraction(-1) <= 0 {
+			return "Mutex profiling is disabled. " +
+				"Call runtime.SetMutexProfileFraction or crashreport.EnableContentionProfiling to enable it."
+		}
+	}
+	return ""
+}
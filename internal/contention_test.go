@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// resetBlockProfileRate restores the recorded block profile rate after the test.
+func resetBlockProfileRate(t *testing.T) {
+	rate, known := blockProfileRate.Load(), blockProfileRateKnown.Load()
+	t.Cleanup(func() {
+		runtime.SetBlockProfileRate(int(rate))
+		blockProfileRate.Store(rate)
+		blockProfileRateKnown.Store(known)
+	})
+}
+
+func TestProfileWarningBlock(t *testing.T) {
+	resetBlockProfileRate(t)
+
+	blockProfileRateKnown.Store(false)
+	if w := profileWarning("block", 0); !strings.Contains(w, "unknown") {
+		t.Errorf("expected a warning that the rate is unknown, got %q", w)
+	}
+
+	SetBlockProfileRate(0)
+	if w := profileWarning("block", 0); !strings.HasPrefix(w, "Block profiling is disabled") {
+		t.Errorf("expected a warning that profiling is disabled, got %q", w)
+	}
+
+	SetBlockProfileRate(1)
+	if w := profileWarning("block", 0); w != "" {
+		t.Errorf("unexpected warning with profiling enabled: %q", w)
+	}
+	SetBlockProfileRate(0)
+
+	if w := profileWarning("block", 1); w != "" {
+		t.Errorf("unexpected warning for a profile that is not empty: %q", w)
+	}
+}
+
+func TestProfileWarningMutex(t *testing.T) {
+	prev := runtime.SetMutexProfileFraction(0)
+	defer runtime.SetMutexProfileFraction(prev)
+
+	if w := profileWarning("mutex", 0); !strings.HasPrefix(w, "Mutex profiling is disabled") {
+		t.Errorf("expected a warning that profiling is disabled, got %q", w)
+	}
+
+	runtime.SetMutexProfileFraction(5)
+	if w := profileWarning("mutex", 0); w != "" {
+		t.Errorf("unexpected warning with profiling enabled: %q", w)
+	}
+}
+
+func TestProfileWarningOther(t *testing.T) {
+	if w := profileWarning("heap", 0); w != "" {
+		t.Errorf("unexpected warning for the heap profile: %q", w)
+	}
+}
@@ -1,13 +1,16 @@
 package internal
 
 import (
+	"archive/zip"
 	"net/http"
 	"net/url"
 	"runtime"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/DataDog/gostackparse"
 	"github.com/google/pprof/driver"
 	"github.com/google/pprof/profile"
 )
@@ -20,6 +23,10 @@ type CrashReport struct {
 	// Profiles profiles included in the crash report
 	Profiles []*Profile
 
+	// Identity identifies the report and the process that wrote it.
+	// This will be nil if report.json does not exist in the crash report file.
+	Identity *Identity
+
 	// SysInfo contains information about the system the process was running in.
 	// This will be nil if [Config.NoSysInfo] is true or if the system.json does
 	// not exist in the crash report file.
@@ -35,9 +42,55 @@ type CrashReport struct {
 	Reason string
 	// Stack the full stack trace of the program
 	Stack string
+	// GoroutineID the id of the goroutine that crashed or created the report.
+	// This is zero if the goroutine file does not exist in the crash report file.
+	GoroutineID int
+	// Goroutines the parsed stack trace.
+	// This is only set for reports created from a textual traceback.
+	Goroutines []*gostackparse.Goroutine
 
 	// Files extra files included in the crash report.
 	Files []string
+	// Attachments data included in the crash report as files.
+	// When reading a crash report these are included in Files instead.
+	Attachments []*Attachment
+
+	// Metadata extra information about the crash report.
+	// This will be nil if metadata.json does not exist in the crash report file.
+	Metadata *Metadata
+
+	// Collection the result of collecting and writing each section of the crash report.
+	// This will be nil if collection.json does not exist in the crash report file.
+	Collection *Collection
+
+	// Occurrence identifies similar crash reports.
+	// This will be nil if occurrence.json does not exist in the crash report file.
+	Occurrence *Occurrence
+
+	// History the recent crashes of the program.
+	// This will be nil if history.json does not exist in the crash report file.
+	History *History
+
+	// sectionTimeout the maximum amount of time spent writing a single section.
+	sectionTimeout time.Duration
+	// entries the entries of the zip file the crash report was read from.
+	entries map[string]*zip.File
+	// limits the size limits used when reading entries.
+	limits Limits
+	// readMu guards read and charged.
+	readMu sync.Mutex
+	// read the total number of uncompressed bytes read from entries.
+	read int64
+	// charged the entries whose size has been added to read.
+	charged map[string]struct{}
+	// problems the entries that could not be read.
+	problems []*Section
+}
+
+// Attachment data included in the crash report as a file.
+type Attachment struct {
+	Name string
+	Data []byte
 }
 
 // SysInfo contains information about the system the process was running in.
@@ -97,16 +150,78 @@ func newSysInfo() *SysInfo {
 type Profile struct {
 	profile []byte
 	name    string
+	file    string
+	warning string
+	text    []byte
+	// named is true if name was set instead of being derived from file.
+	named bool
+
+	// report the crash report the profile is read from.
+	// This is nil for profiles that are being written.
+	report *CrashReport
+	// hasText is true if the profile read from report has a text form.
+	hasText bool
 }
 
-func (p *Profile) URL() string  { return strings.ToLower(p.name) }
+// FileName the name of the profile file in the crash report without the extension.
+func (p *Profile) FileName() string { return p.file }
+
+func (p *Profile) URL() string  { return strings.ToLower(strings.ReplaceAll(p.file, ".", "-")) }
 func (p *Profile) Name() string { return p.name }
 
-func (p *Profile) Profile() (*profile.Profile, error) {
-	return profile.ParseData(p.profile)
+// Warning returns a warning explaining why the profile may be empty.
+func (p *Profile) Warning() string { return p.warning }
+
+// Profile parses the profile.
+// Panics caused by malformed profiles are returned as errors.
+func (p *Profile) Profile() (prof *profile.Profile, err error) {
+	buf, err := p.ReadProfileBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = call(func() (err error) {
+		prof, err = profile.ParseData(buf)
+		return err
+	})
+	return prof, err
+}
+
+// ProfileBytes returns the profile in the gzip compressed protobuf format.
+// nil is returned if the profile cannot be read. See [Profile.ReadProfileBytes].
+func (p *Profile) ProfileBytes() []byte {
+	buf, _ := p.ReadProfileBytes()
+	return buf
+}
+
+// ReadProfileBytes returns the profile in the gzip compressed protobuf format.
+// Profiles read from a crash report are read every time this is called.
+func (p *Profile) ReadProfileBytes() ([]byte, error) {
+	if p.report == nil {
+		return p.profile, nil
+	}
+	return p.report.readFile("profiles/"+p.file+".prof", p.report.limits.Profile)
+}
+
+// HasText checks if the profile was included in text form.
+func (p *Profile) HasText() bool { return len(p.text) != 0 || p.hasText }
+
+// Text returns the text form of the profile.
+// This is nil if the profile was not included in text form or cannot be read. See [Profile.ReadText].
+func (p *Profile) Text() []byte {
+	text, _ := p.ReadText()
+	return text
 }
 
-func (p *Profile) ProfileBytes() []byte { return p.profile }
+// ReadText returns the text form of the profile.
+// This is nil if the profile was not included in text form.
+// Profiles read from a crash report are read every time this is called.
+func (p *Profile) ReadText() ([]byte, error) {
+	if p.report == nil || !p.hasText {
+		return p.text, nil
+	}
+	return p.report.readFile("profiles/"+p.file+".txt", p.report.limits.Profile)
+}
 
 func (p *Profile) Register(mux *http.ServeMux) error {
 	prof, err := p.Profile()
@@ -127,6 +242,16 @@ func (p *Profile) Register(mux *http.ServeMux) error {
 	}, UI: &profUI{}, Flagset: &fakeFlags{}, Fetch: &fetcher{P: prof}})
 }
 
+// profileFile returns the file name used for the profile with the given name.
+// Path separators are replaced since custom profiles are often named after import paths.
+func profileFile(name string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", "\x00", "_").Replace(name)
+}
+
 func NewProfile(name string, prof []byte) *Profile {
-	return &Profile{profile: prof, name: strings.Title(name)}
+	title := strings.Title(name)
+	if base := strings.TrimSuffix(name, deltaSuffix); base != name {
+		title = strings.Title(base) + " (delta)"
+	}
+	return &Profile{profile: prof, name: title, file: name}
 }
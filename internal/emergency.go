@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+)
+
+// pageSize the size of the pages written to when reserving memory.
+const pageSize = 4096
+
+// Emergency resources that are reserved while memory is available, so a crash report
+// can still be written when the process is close to running out of memory.
+type Emergency struct {
+	// ballast memory released before the report is written.
+	ballast []byte
+	// stack the buffer the stack of the crashing goroutine is written to.
+	stack []byte
+	// buf the buffer json entries are encoded into.
+	buf *bytes.Buffer
+	// file the file the report is written to.
+	file *os.File
+
+	memstats runtime.MemStats
+}
+
+// emergencyPrefix the prefix of the names of the files reserved by [NewEmergency].
+// The name also contains the pid of the process that reserved the file.
+const emergencyPrefix = ".crashreport-emergency-"
+
+// NewEmergency reserves ballast bytes of memory, a buffer of stackSize bytes for the
+// stack of the crashing goroutine and a temporary file in dir.
+// The file is removed by [Emergency.Close]. Files left behind by processes that exited
+// without calling Close are removed by [RemoveStaleEmergencyFiles].
+func NewEmergency(dir string, ballast, stackSize int) (*Emergency, error) {
+	f, err := os.CreateTemp(dir, emergencyPrefix+strconv.Itoa(os.Getpid())+"-*")
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Emergency{
+		ballast: make([]byte, ballast),
+		stack:   make([]byte, stackSize),
+		buf:     bytes.NewBuffer(make([]byte, 0, 64*1024)),
+		file:    f,
+	}
+
+	// the memory is only allocated by the os once it is written to.
+	for _, b := range [][]byte{e.ballast, e.stack, e.buf.Bytes()[:e.buf.Cap()]} {
+		for i := 0; i < len(b); i += pageSize {
+			b[i] = 1
+		}
+	}
+
+	return e, nil
+}
+
+// Release releases the ballast so the memory can be used to write the crash report.
+func (e *Emergency) Release() {
+	if e.ballast != nil {
+		e.ballast = nil
+		runtime.GC()
+	}
+}
+
+// Close closes and removes the temporary file if it was not used.
+func (e *Emergency) Close() error {
+	e.ballast = nil
+	if e.file == nil {
+		return nil
+	}
+
+	err := e.file.Close()
+	os.Remove(e.file.Name())
+	e.file = nil
+	return err
+}
+
+// WriteMinimal writes a minimal crash report to the reserved file and renames it to filename.
+// The report only contains the reason, identity, metadata, occurrence and history from c, the stack of
+// the calling goroutine and memory statistics.
+// Entries are stored without compression using the reserved buffers, so only a small amount of memory is allocated.
+// The reserved file cannot be used again after this returns.
+func (e *Emergency) WriteMinimal(filename string, c Config) (err error) {
+	if e.file == nil {
+		return errors.New("the reserved file was already used")
+	}
+	defer e.Close()
+
+	stack := e.stack[:runtime.Stack(e.stack, false)]
+	header := stack
+	if i := bytes.IndexByte(stack, '\n'); i >= 0 {
+		header = stack[:i]
+	}
+	id, _ := parseGoroutineID(string(header))
+	runtime.ReadMemStats(&e.memstats)
+
+	col := &Collection{}
+	col.add(StageCollect, "emergency", 0, false, errors.New("only a minimal report was written because memory was low"))
+
+	n, err := e.file.WriteString(Header + c.Identity.header())
+	if err != nil {
+		return fmt.Errorf("unable to write header: %w", err)
+	}
+
+	zw := zip.NewWriter(e.file)
+	zw.SetOffset(int64(n))
+
+	write := func(name string, data []byte) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			return fmt.Errorf("unable to create file %s in zip archive: %w", name, err)
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	writeJSON := func(name string, v any) error {
+		e.buf.Reset()
+		if err := json.NewEncoder(e.buf).Encode(v); err != nil {
+			return err
+		}
+		return write(name, e.buf.Bytes())
+	}
+
+	entries := []func() error{
+		func() error { return write("reason", []byte(strings.Join(c.Reason, "\n"))) },
+		func() error { return write("stack", stack) },
+		func() error { return write("goroutine", []byte(strconv.Itoa(id))) },
+		func() error { return writeJSON("memstats.json", &e.memstats) },
+	}
+	if c.Identity != nil {
+		entries = append(entries, func() error { return writeJSON("report.json", c.Identity) })
+	}
+	if c.Occurrence != nil {
+		entries = append(entries, func() error { return writeJSON("occurrence.json", c.Occurrence) })
+	}
+	if c.History != nil {
+		entries = append(entries, func() error { return writeJSON("history.json", c.History) })
+	}
+	if !c.Metadata.Empty() {
+		entries = append(entries, func() error { return writeJSON("metadata.json", &c.Metadata) })
+	}
+	entries = append(entries, func() error { return writeJSON("collection.json", col) })
+
+	for _, entry := range entries {
+		if err = entry(); err != nil {
+			return err
+		}
+	}
+
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = e.file.Sync(); err != nil {
+		return err
+	}
+	if err = e.file.Close(); err != nil {
+		return err
+	}
+
+	name := e.file.Name()
+	e.file = nil
+	if err = os.Rename(name, filename); err != nil {
+		os.Remove(name)
+		return err
+	}
+	return nil
+}
+
+// RemoveStaleEmergencyFiles removes the files reserved by [NewEmergency] in dir
+// by processes that are no longer running.
+func RemoveStaleEmergencyFiles(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		rest := strings.TrimPrefix(entry.Name(), emergencyPrefix)
+		if rest == entry.Name() || entry.IsDir() {
+			continue
+		}
+
+		pid, _, _ := strings.Cut(rest, "-")
+		if id, err := strconv.Atoi(pid); err == nil && id != os.Getpid() && !processExists(id) {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// MemoryHeadroom returns the number of bytes that can be allocated before the memory
+// limit is reached. If limit is zero the limit set using [debug.SetMemoryLimit] is used.
+// false is returned if there is no memory limit.
+func MemoryHeadroom(limit int64) (uint64, bool) {
+	if limit <= 0 {
+		if limit = debug.SetMemoryLimit(-1); limit == math.MaxInt64 {
+			return 0, false
+		}
+	}
+
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+
+	used := samples[0].Value.Uint64() - samples[1].Value.Uint64()
+	if used >= uint64(limit) {
+		return 0, true
+	}
+	return uint64(limit) - used, true
+}
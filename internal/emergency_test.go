@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// deadPID a pid that is larger than the pid of any running process.
+const deadPID = 1 << 30
+
+func TestEmergencyClose(t *testing.T) {
+	dir := t.TempDir()
+	e, err := NewEmergency(dir, 1<<20, 1<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := dirEntries(t, dir)
+	if len(names) != 1 || !strings.HasPrefix(names[0], emergencyPrefix+strconv.Itoa(os.Getpid())+"-") {
+		t.Fatalf("unexpected reserved files %v", names)
+	}
+
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if names = dirEntries(t, dir); len(names) != 0 {
+		t.Errorf("reserved file was not removed: %v", names)
+	}
+}
+
+func TestEmergencyWriteMinimal(t *testing.T) {
+	dir := t.TempDir()
+	e, err := NewEmergency(dir, 1<<20, 1<<14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	identity := NewIdentity("service", "")
+	path := filepath.Join(dir, "report.crash")
+	e.Release()
+	err = e.WriteMinimal(path, Config{
+		Reason:     []string{"low memory"},
+		Identity:   identity,
+		Occurrence: &Occurrence{Fingerprint: "abc"},
+		Metadata:   Metadata{Values: map[string]string{"k": "v"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := dirEntries(t, dir); len(names) != 1 || names[0] != "report.crash" {
+		t.Errorf("the reserved file was not renamed: %v", names)
+	}
+
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := readBytes(t, buf)
+	if report.Reason != "low memory" || report.Identity.ID != identity.ID || report.Occurrence.Fingerprint != "abc" {
+		t.Errorf("unexpected report %q %+v %+v", report.Reason, report.Identity, report.Occurrence)
+	}
+	if report.GoroutineID != CurrentGoroutineID() || !strings.Contains(report.Stack, "TestEmergencyWriteMinimal") {
+		t.Errorf("the stack of the calling goroutine was not written: %d\n%s", report.GoroutineID, report.Stack)
+	}
+	if report.Memstats.Sys == 0 || report.Metadata.Values["k"] != "v" {
+		t.Error("memstats or metadata were not written")
+	}
+	if findSection(report.Collection, StageCollect, "emergency") == nil {
+		t.Error("the report is not marked as minimal")
+	}
+
+	if err = e.WriteMinimal(filepath.Join(dir, "again.crash"), Config{}); err == nil {
+		t.Error("the reserved file was used twice")
+	}
+}
+
+func TestRemoveStaleEmergencyFiles(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		emergencyPrefix + strconv.Itoa(deadPID) + "-1",
+		emergencyPrefix + strconv.Itoa(os.Getpid()) + "-2",
+		"report.crash",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	RemoveStaleEmergencyFiles(dir)
+
+	expected := names
+	if !processExists(deadPID) {
+		expected = names[1:]
+	}
+	sort.Strings(expected)
+	got := dirEntries(t, dir)
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
+
+func TestMemoryHeadroom(t *testing.T) {
+	if headroom, ok := MemoryHeadroom(1 << 50); !ok || headroom == 0 {
+		t.Errorf("got %d, %v for a large limit", headroom, ok)
+	}
+	if headroom, ok := MemoryHeadroom(1); !ok || headroom != 0 {
+		t.Errorf("got %d, %v for a limit that is exceeded", headroom, ok)
+	}
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/DataDog/gostackparse"
+)
+
+// modulePath the import path of this module.
+// Frames from this module are ignored when computing a fingerprint.
+const modulePath = "github.com/yehan2002/crashreport"
+
+// Occurrence identifies similar crash reports.
+type Occurrence struct {
+	// Fingerprint a stable identifier computed from the crashing goroutine's stack.
+	Fingerprint string
+	// Suppressed the number of reports with the same fingerprint that were
+	// suppressed since the last report was written.
+	Suppressed int
+}
+
+// Fingerprint computes a stable fingerprint from the goroutine with the given id in stack.
+// If id is zero the first goroutine is used.
+// Line numbers and arguments are not included so the fingerprint does not change
+// between builds unless the call path changes.
+func Fingerprint(stack string, id int) string {
+	stack = goroutineStack(stack, id)
+	goroutines, _ := gostackparse.Parse(strings.NewReader(stack))
+	if len(goroutines) == 0 {
+		return FingerprintStrings(stack)
+	}
+
+	g := goroutines[0]
+	frames := g.Stack
+
+	// If the goroutine is panicking only the frames that caused the panic are used.
+	// This excludes deferred functions that were called after the panic.
+	for i := len(frames) - 1; i >= 0; i-- {
+		if frames[i].Func == "panic" || frames[i].Func == "runtime.gopanic" {
+			frames = frames[i+1:]
+			break
+		}
+	}
+
+	var funcs []string
+	for _, frame := range frames {
+		if isInternalFrame(frame.Func) {
+			continue
+		}
+		funcs = append(funcs, frame.Func)
+	}
+
+	if g.CreatedBy != nil {
+		created, _, _ := strings.Cut(g.CreatedBy.Func, " in goroutine ")
+		funcs = append(funcs, "created by "+created)
+	}
+
+	return FingerprintStrings(funcs...)
+}
+
+// FingerprintStrings computes a fingerprint from the given strings.
+func FingerprintStrings(s ...string) string {
+	h := sha256.New()
+	for _, v := range s {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// isInternalFrame checks if the given function belongs to this module or
+// is used to capture a stack trace.
+func isInternalFrame(fn string) bool {
+	switch fn {
+	case "runtime.Stack", "runtime/debug.Stack":
+		return true
+	}
+	return strings.HasPrefix(fn, modulePath+".") || strings.HasPrefix(fn, modulePath+"/")
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const fingerprintStack = `goroutine 7 [running]:
+main.worker(0xc000010000, 0x3)
+	/src/main.go:%d +0x1d
+main.main()
+	/src/main.go:10 +0x25
+
+goroutine 1 [chan receive]:
+main.other()
+	/src/main.go:40 +0x1d
+`
+
+func stackWithLine(line int) string {
+	return fmt.Sprintf(fingerprintStack, line)
+}
+
+func TestFingerprintIgnoresLinesAndArguments(t *testing.T) {
+	a := Fingerprint(stackWithLine(20), 7)
+	b := Fingerprint(strings.Replace(stackWithLine(25), "0xc000010000, 0x3", "0xc000020000, 0x4", 1), 7)
+	if a != b {
+		t.Errorf("fingerprints differ: %s != %s", a, b)
+	}
+}
+
+func TestFingerprintUsesGoroutine(t *testing.T) {
+	stack := stackWithLine(20)
+	if Fingerprint(stack, 7) == Fingerprint(stack, 1) {
+		t.Error("different goroutines have the same fingerprint")
+	}
+	if Fingerprint(stack, 0) != Fingerprint(stack, 7) {
+		t.Error("id 0 did not use the first goroutine")
+	}
+}
+
+func TestFingerprintPanic(t *testing.T) {
+	// frames above the panic are deferred functions that ran after it.
+	stack := `goroutine 1 [running]:
+main.deferred()
+	/src/main.go:5 +0x1d
+panic({0x0, 0x0})
+	/go/src/runtime/panic.go:770 +0x132
+main.crash()
+	/src/main.go:15 +0x25
+`
+	other := strings.Replace(stack, "main.deferred", "main.otherDeferred", 1)
+	if Fingerprint(stack, 1) != Fingerprint(other, 1) {
+		t.Error("deferred functions changed the fingerprint")
+	}
+
+	crash := strings.Replace(stack, "main.crash", "main.otherCrash", 1)
+	if Fingerprint(stack, 1) == Fingerprint(crash, 1) {
+		t.Error("different call paths have the same fingerprint")
+	}
+}
+
+func TestFingerprintIgnoresModuleFrames(t *testing.T) {
+	stack := `goroutine 1 [running]:
+` + modulePath + `.Recover()
+	/mod/recover.go:17 +0x1d
+main.crash()
+	/src/main.go:15 +0x25
+`
+	other := strings.Replace(stack, modulePath+".Recover", modulePath+".RecoverContext", 1)
+	if Fingerprint(stack, 1) != Fingerprint(other, 1) {
+		t.Error("frames of this module changed the fingerprint")
+	}
+}
+
+func TestFingerprintStrings(t *testing.T) {
+	if FingerprintStrings("a", "b") != FingerprintStrings("a", "b") {
+		t.Error("fingerprint is not deterministic")
+	}
+	if FingerprintStrings("ab") == FingerprintStrings("a", "b") {
+		t.Error("strings are not separated")
+	}
+	if len(FingerprintStrings("a")) != 16 {
+		t.Errorf("unexpected length %d", len(FingerprintStrings("a")))
+	}
+}
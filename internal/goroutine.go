@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// maxStackSize the maximum size of the buffer used to capture the stack of all goroutines.
+const maxStackSize = 64 << 20 // 64MB
+
+// CurrentGoroutineID returns the id of the calling goroutine.
+func CurrentGoroutineID() int {
+	var buf [64]byte
+	id, _ := parseGoroutineID(string(buf[:runtime.Stack(buf[:], false)]))
+	return id
+}
+
+// parseGoroutineID parses the id from a goroutine header like "goroutine 1 [running]:".
+func parseGoroutineID(header string) (int, bool) {
+	if !strings.HasPrefix(header, "goroutine ") {
+		return 0, false
+	}
+	rest := strings.TrimPrefix(header, "goroutine ")
+
+	end := strings.IndexByte(rest, ' ')
+	if end == -1 {
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(rest[:end])
+	return id, err == nil
+}
+
+// stackAll returns the stack of all goroutines.
+// The buffer is grown until the whole stack fits, up to [maxStackSize].
+func stackAll() string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxStackSize {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// GoroutineStack the stack of a single goroutine.
+type GoroutineStack struct {
+	// ID the id of the goroutine. This is zero if it could not be parsed.
+	ID int
+	// Header the first line of the stack. For example "goroutine 1 [running]:".
+	Header string
+	// Stack the rest of the stack.
+	Stack string
+}
+
+// SplitStack splits a stack trace containing multiple goroutines.
+func SplitStack(stack string) []*GoroutineStack {
+	var goroutines []*GoroutineStack
+	for _, block := range strings.Split(strings.TrimSpace(stack), "\n\n") {
+		if block = strings.TrimSpace(block); block == "" {
+			continue
+		}
+
+		header, rest, _ := strings.Cut(block, "\n")
+		id, _ := parseGoroutineID(header)
+		goroutines = append(goroutines, &GoroutineStack{ID: id, Header: header, Stack: rest})
+	}
+	return goroutines
+}
+
+// goroutineStack returns the stack of the goroutine with the given id from stack.
+// If id is zero or not found, the first goroutine is returned.
+func goroutineStack(stack string, id int) string {
+	goroutines := SplitStack(stack)
+	if len(goroutines) == 0 {
+		return stack
+	}
+
+	for _, g := range goroutines {
+		if id != 0 && g.ID == id {
+			return g.Header + "\n" + g.Stack
+		}
+	}
+	return goroutines[0].Header + "\n" + goroutines[0].Stack
+}
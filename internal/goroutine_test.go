@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const testStack = `goroutine 5 [running]:
+main.a()
+	/src/main.go:5 +0x25
+
+goroutine 1 [chan receive]:
+main.main()
+	/src/main.go:10 +0x30
+`
+
+func TestParseGoroutineID(t *testing.T) {
+	for header, expected := range map[string]int{
+		"goroutine 1 [running]:":                    1,
+		"goroutine 42 gp=0xc000002380 m=0 [sleep]:": 42,
+		"goroutine x [running]:":                    0,
+		"main.main()":                               0,
+	} {
+		if id, _ := parseGoroutineID(header); id != expected {
+			t.Errorf("%q: got %d, expected %d", header, id, expected)
+		}
+	}
+}
+
+func TestCurrentGoroutineID(t *testing.T) {
+	id := CurrentGoroutineID()
+	buf := make([]byte, 64)
+	if header := string(buf[:runtime.Stack(buf, false)]); !strings.HasPrefix(header, "goroutine ") || id == 0 {
+		t.Fatalf("unexpected id %d for %q", id, header)
+	}
+
+	other := make(chan int)
+	go func() { other <- CurrentGoroutineID() }()
+	if o := <-other; o == id || o == 0 {
+		t.Errorf("goroutines have the ids %d and %d", id, o)
+	}
+}
+
+func TestSplitStack(t *testing.T) {
+	goroutines := SplitStack(testStack)
+	if len(goroutines) != 2 {
+		t.Fatalf("expected 2 goroutines, got %d", len(goroutines))
+	}
+	if g := goroutines[1]; g.ID != 1 || g.Header != "goroutine 1 [chan receive]:" || !strings.HasPrefix(g.Stack, "main.main()") {
+		t.Errorf("unexpected goroutine %+v", g)
+	}
+
+	if s := goroutineStack(testStack, 1); !strings.HasPrefix(s, "goroutine 1 ") {
+		t.Errorf("wrong goroutine selected: %q", s)
+	}
+	// unknown ids use the first goroutine.
+	if s := goroutineStack(testStack, 99); !strings.HasPrefix(s, "goroutine 5 ") {
+		t.Errorf("wrong goroutine selected: %q", s)
+	}
+}
+
+func TestCreateGoroutineID(t *testing.T) {
+	report := roundTrip(t, Config{})
+	if report.GoroutineID != CurrentGoroutineID() {
+		t.Errorf("expected the calling goroutine %d, got %d", CurrentGoroutineID(), report.GoroutineID)
+	}
+
+	report = roundTrip(t, Config{GoroutineID: 12345})
+	if report.GoroutineID != 12345 {
+		t.Errorf("the configured id was not used: %d", report.GoroutineID)
+	}
+}
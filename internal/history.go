@@ -0,0 +1,34 @@
+package internal
+
+import "time"
+
+// History a summary of the recent crashes of the program.
+type History struct {
+	// Window the duration Count is computed over.
+	Window time.Duration
+	// Count the number of crashes within Window when the report was written.
+	Count int
+	// Crashes the most recent crashes, oldest first.
+	// If the report was written for a crash, it is the last crash.
+	Crashes []*Crash
+}
+
+// Crash a crash of the program recorded in the crash history.
+type Crash struct {
+	// Time the time of the crash.
+	Time time.Time
+	// Kind the kind of report written for the crash.
+	Kind string
+	// Fingerprint the fingerprint of the crash. See [Occurrence].
+	Fingerprint string
+	// PID the process id of the program that crashed.
+	PID int
+}
+
+// Last returns the most recent crash or nil if there are no crashes.
+func (h *History) Last() *Crash {
+	if h == nil || len(h.Crashes) == 0 {
+		return nil
+	}
+	return h.Crashes[len(h.Crashes)-1]
+}
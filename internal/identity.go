@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// crockford the alphabet used to encode report ids.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Identity identifies a crash report and the process that wrote it.
+type Identity struct {
+	// ID the unique id of the report. This is a ULID.
+	ID string
+	// Hostname the hostname of the system the process was running on.
+	Hostname string `json:",omitempty"`
+	// PID the process id.
+	PID int `json:",omitempty"`
+	// ProcessStart the time the process started.
+	ProcessStart time.Time
+	// Service the name of the service, if it was set.
+	Service string `json:",omitempty"`
+	// Instance the id of the instance of the service, if it was set.
+	Instance string `json:",omitempty"`
+}
+
+// NewIdentity returns the identity of a new report written by this process.
+func NewIdentity(service, instance string) *Identity {
+	hostname, _ := os.Hostname()
+	return &Identity{
+		ID:           NewID(),
+		Hostname:     hostname,
+		PID:          os.Getpid(),
+		ProcessStart: startTime,
+		Service:      service,
+		Instance:     instance,
+	}
+}
+
+// NewID returns a new ULID. See https://github.com/ulid/spec.
+// The first 48 bits are the current time in milliseconds and the remaining 80 bits are random,
+// so ids sort by the time they were created.
+func NewID() string {
+	var id [16]byte
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(id[:6], ms[2:])
+	if _, err := rand.Read(id[6:]); err != nil {
+		// the time and pid still make the id unique within a host.
+		binary.BigEndian.PutUint64(id[8:], uint64(time.Now().UnixNano())^uint64(os.Getpid())<<32)
+	}
+
+	// 26 characters of 5 bits encode the 128 bits of the id after two leading zero bits.
+	var s [26]byte
+	for i := range s {
+		var v byte
+		for b := i*5 - 2; b < i*5+3; b++ {
+			v <<= 1
+			if b >= 0 && id[b/8]&(0x80>>(b%8)) != 0 {
+				v |= 1
+			}
+		}
+		s[i] = crockford[v]
+	}
+	return string(s[:])
+}
+
+// header returns the lines added to [Header] for the report.
+func (i *Identity) header() string {
+	if i == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "id: %s\n", i.ID)
+	if i.Hostname != "" {
+		fmt.Fprintf(&b, "host: %s\n", i.Hostname)
+	}
+	if i.PID != 0 {
+		fmt.Fprintf(&b, "pid: %d\n", i.PID)
+	}
+	if !i.ProcessStart.IsZero() {
+		fmt.Fprintf(&b, "process start: %s\n", i.ProcessStart.Format(time.RFC3339))
+	}
+	if i.Service != "" {
+		fmt.Fprintf(&b, "service: %s\n", i.Service)
+	}
+	if i.Instance != "" {
+		fmt.Fprintf(&b, "instance: %s\n", i.Instance)
+	}
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeTime decodes the time in milliseconds stored in the first 10 characters of a ULID.
+func decodeTime(t *testing.T, id string) int64 {
+	t.Helper()
+	var ms int64
+	for _, c := range id[:10] {
+		i := strings.IndexRune(crockford, c)
+		if i < 0 {
+			t.Fatalf("invalid character %q in %s", c, id)
+		}
+		ms = ms<<5 | int64(i)
+	}
+	return ms
+}
+
+func TestNewID(t *testing.T) {
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	id := NewID()
+	after := time.Now().UnixNano() / int64(time.Millisecond)
+
+	if len(id) != 26 || id[0] > '7' {
+		t.Fatalf("invalid ULID %q", id)
+	}
+	for _, c := range id {
+		if !strings.ContainsRune(crockford, c) {
+			t.Fatalf("invalid character %q in %s", c, id)
+		}
+	}
+	if ms := decodeTime(t, id); ms < before || ms > after {
+		t.Errorf("id contains the time %d, expected %d-%d", ms, before, after)
+	}
+
+	seen := map[string]bool{id: true}
+	for i := 0; i < 1000; i++ {
+		if id = NewID(); seen[id] {
+			t.Fatalf("duplicate id %s", id)
+		}
+		seen[id] = true
+	}
+
+	// ids sort by the time they were created.
+	first := NewID()
+	time.Sleep(2 * time.Millisecond)
+	if second := NewID(); second <= first {
+		t.Errorf("%s was created after %s", second, first)
+	}
+}
+
+func TestIdentityHeader(t *testing.T) {
+	identity := NewIdentity("api", "api-1")
+	if identity.PID != os.Getpid() || identity.ProcessStart.IsZero() {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	buf := writeReport(t, Config{Identity: identity})
+	header := string(buf[:bytes.Index(buf, []byte("PK"))])
+	for _, line := range []string{"id: " + identity.ID + "\n", "pid: ", "process start: ", "service: api\n", "instance: api-1\n"} {
+		if !strings.Contains(header, line) {
+			t.Errorf("header does not contain %q:\n%s", line, header)
+		}
+	}
+
+	read := readBytes(t, buf)
+	identity.ProcessStart = identity.ProcessStart.Round(0)
+	if !read.Identity.ProcessStart.Equal(identity.ProcessStart) {
+		t.Errorf("process start %s was read as %s", identity.ProcessStart, read.Identity.ProcessStart)
+	}
+	read.Identity.ProcessStart = identity.ProcessStart
+	if *read.Identity != *identity {
+		t.Errorf("got %+v, expected %+v", read.Identity, identity)
+	}
+}
@@ -0,0 +1,46 @@
+package internal
+
+// Metadata extra information about the crash report.
+type Metadata struct {
+	// Values key value pairs added to the report.
+	Values map[string]string `json:",omitempty"`
+	// Labels the pprof labels of the goroutine that created the report.
+	Labels map[string]string `json:",omitempty"`
+}
+
+// Set sets the value for the given key.
+func (m *Metadata) Set(key, value string) {
+	if m.Values == nil {
+		m.Values = map[string]string{}
+	}
+	m.Values[key] = value
+}
+
+// SetLabel sets the given pprof label.
+func (m *Metadata) SetLabel(key, value string) {
+	if m.Labels == nil {
+		m.Labels = map[string]string{}
+	}
+	m.Labels[key] = value
+}
+
+// Empty checks if m contains no values.
+func (m *Metadata) Empty() bool {
+	return m == nil || (len(m.Values) == 0 && len(m.Labels) == 0)
+}
+
+// clone returns a copy of m.
+func (m *Metadata) clone() *Metadata {
+	if m.Empty() {
+		return nil
+	}
+
+	c := &Metadata{}
+	for k, v := range m.Values {
+		c.Set(k, v)
+	}
+	for k, v := range m.Labels {
+		c.SetLabel(k, v)
+	}
+	return c
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package internal
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processExists checks if a process with the given pid is running.
+func processExists(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"fmt"
+	"runtime/pprof"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// profileID makes the names of profiles registered by tests unique,
+// since profiles cannot be unregistered.
+var profileID int64
+
+// newTestProfile registers a new profile whose name starts with prefix.
+func newTestProfile(prefix string) *pprof.Profile {
+	return pprof.NewProfile(fmt.Sprintf("%s-%d", prefix, atomic.AddInt64(&profileID, 1)))
+}
+
+func TestCheckProfiles(t *testing.T) {
+	slash := newTestProfile("crashreport.test/a")
+	underscore := pprof.NewProfile(profileFile(slash.Name()))
+
+	c := Config{
+		Profiles: map[string]struct{}{"heap": {}, slash.Name(): {}, underscore.Name(): {}, "unknown-profile": {}},
+	}
+	names, problems := c.CheckProfiles()
+
+	// "crashreport.test/a-N" sorts before "crashreport.test_a-N", so the underscore is rejected.
+	expected := []string{slash.Name(), "heap"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("got %v, expected %v", names, expected)
+	}
+
+	errs := map[string]string{}
+	for _, p := range problems {
+		if p.Stage != StageConfig {
+			t.Errorf("unexpected stage %s", p.Stage)
+		}
+		errs[p.Name] = p.Error
+	}
+	if !strings.Contains(errs["profiles/unknown-profile"], "unknown profile") {
+		t.Errorf("unknown profile was not reported: %v", errs)
+	}
+	if !strings.Contains(errs["profiles/"+underscore.Name()], "already used") {
+		t.Errorf("file name collision was not reported: %v", errs)
+	}
+}
+
+func TestCheckProfilesDelta(t *testing.T) {
+	// a custom profile stored in the same file as the delta heap profile.
+	custom := pprof.NewProfile(fmt.Sprintf("crashreport-test-%d", atomic.AddInt64(&profileID, 1)))
+	c := Config{
+		Profiles: map[string]struct{}{"heap": {}, "heap.delta": {}},
+		Custom:   map[string]*CustomProfile{"heap.delta": {Profile: custom}},
+	}
+
+	if names, problems := c.CheckProfiles(); len(names) != 2 || len(problems) != 0 {
+		t.Errorf("unexpected result without delta profiles: %v %v", names, problems)
+	}
+
+	c.Delta = true
+	if names, problems := c.CheckProfiles(); len(names) != 1 || len(problems) != 1 || problems[0].Name != "profiles/heap.delta" {
+		t.Errorf("collision with the delta profile was not reported: %v %v", names, problems)
+	}
+}
+
+func TestCheckProfilesLateRegistration(t *testing.T) {
+	name := fmt.Sprintf("crashreport.test/late-%d", atomic.AddInt64(&profileID, 1))
+	c := Config{Profiles: map[string]struct{}{name: {}}}
+
+	if _, problems := c.CheckProfiles(); len(problems) != 1 {
+		t.Fatalf("unregistered profile was not reported: %v", problems)
+	}
+
+	pprof.NewProfile(name)
+	if names, problems := c.CheckProfiles(); len(names) != 1 || len(problems) != 0 {
+		t.Errorf("profile registered later was not found: %v %v", names, problems)
+	}
+}
+
+func TestProfileNameRoundTrip(t *testing.T) {
+	slash := newTestProfile("crashreport.test/named")
+	custom := pprof.NewProfile(fmt.Sprintf("crashreport-test-%d", atomic.AddInt64(&profileID, 1)))
+
+	report := roundTrip(t, Config{
+		Profiles: map[string]struct{}{slash.Name(): {}, "custom": {}, "heap": {}},
+		Custom:   map[string]*CustomProfile{"custom": {Profile: custom, Name: "My Profile"}},
+	})
+
+	for file, display := range map[string]string{
+		profileFile(slash.Name()): slash.Name(),
+		"custom":                  "My Profile",
+		"heap":                    "Heap",
+	} {
+		p := findProfile(t, report, file)
+		if p.Name() != display {
+			t.Errorf("%s: got display name %q, expected %q", file, p.Name(), display)
+		}
+	}
+}
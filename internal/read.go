@@ -8,146 +8,393 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
-	"os"
 	"path"
 	"reflect"
 	"runtime"
 	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
 )
 
-// maxSize the max size for a file inside the crash report
-const maxSize = 1024 * 1024 // 1MB
+// Limits the maximum size of each type of entry read from a crash report.
+// A limit of zero uses the default limit for the entry type and a negative limit disables the limit.
+type Limits struct {
+	// Text the limit for the reason, stack and goroutine entries. Defaults to 64MB.
+	Text int64
+	// JSON the limit for each json entry. Defaults to 64MB.
+	JSON int64
+	// Profile the limit for each profile in both the protobuf and text form. Defaults to 256MB.
+	Profile int64
+	// File the limit for included files read using [CrashReport.ReadFile]. Defaults to 256MB.
+	// Files opened using [CrashReport.Open] are not limited.
+	File int64
 
-// Read reads a crash report from the zip file
-func Read(r io.Reader) (report *CrashReport, err error) {
-	report = &CrashReport{
-		Build:    &debug.BuildInfo{},
-		SysInfo:  &SysInfo{},
-		Memstats: &runtime.MemStats{},
+	// Ratio the maximum compression ratio of an entry. Defaults to 200.
+	// Entries smaller than 1MB are not checked.
+	Ratio int64
+	// Total the maximum number of uncompressed bytes read from all entries
+	// that are read into memory. Each entry is only counted the first time
+	// it is read successfully. Defaults to 1GB.
+	Total int64
+}
+
+// DefaultLimits the limits used for entries that do not have a limit set.
+var DefaultLimits = Limits{
+	Text:    64 << 20,
+	JSON:    64 << 20,
+	Profile: 256 << 20,
+	File:    256 << 20,
+	Ratio:   200,
+	Total:   1 << 30,
+}
+
+// minRatioSize the minimum size of entries that are checked against [Limits.Ratio].
+const minRatioSize = 1 << 20
+
+// withDefaults returns a copy of l with unset limits replaced with the default limit.
+func (l Limits) withDefaults() Limits {
+	set := func(v *int64, def int64) {
+		if *v == 0 {
+			*v = def
+		}
 	}
+	set(&l.Text, DefaultLimits.Text)
+	set(&l.JSON, DefaultLimits.JSON)
+	set(&l.Profile, DefaultLimits.Profile)
+	set(&l.File, DefaultLimits.File)
+	set(&l.Ratio, DefaultLimits.Ratio)
+	set(&l.Total, DefaultLimits.Total)
+	return l
+}
 
+// Read reads a crash report from the zip file.
+// The whole file is read into memory. Use [ReadAt] to read entries when they are used.
+func Read(r io.Reader) (*CrashReport, error) {
 	buf, err := io.ReadAll(r)
 	if err != nil {
 		return nil, fmt.Errorf("unable to read file: %w", err)
 	}
 
-	zr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	return ReadAt(bytes.NewReader(buf), int64(len(buf)))
+}
+
+// ReadAt reads a crash report from the zip file r with the given size.
+// Only the small entries of the crash report are read immediately. Profiles and included
+// files are read from r when they are used, so r must remain valid while the report is used.
+//
+// r is treated as untrusted. Entries that cannot be read are recorded in [CrashReport.Collection]
+// with the stage [StageRead] instead of causing an error. If the zip file is corrupt, the entries
+// that can still be read are recovered. An error is only returned if nothing can be recovered.
+func ReadAt(r io.ReaderAt, size int64) (*CrashReport, error) {
+	return ReadAtLimits(r, size, Limits{})
+}
+
+// ReadIdentity reads only the identity of the crash report in the zip file r with the given size.
+// [fs.ErrNotExist] is returned if the report does not have an identity.
+func ReadIdentity(r io.ReaderAt, size int64) (*Identity, error) {
+	zr, err := zip.NewReader(r, size)
 	if err != nil {
 		return nil, fmt.Errorf("unable read zip file: %w", err)
 	}
 
-	if err = report.readToString(zr, "reason", &report.Reason); err != nil {
-		return nil, err
-	}
+	report := &CrashReport{limits: Limits{}.withDefaults()}
+	report.index(zr)
 
-	if err = report.readToString(zr, "stack", &report.Stack); err != nil {
+	buf, err := report.readFile("report.json", 64<<10)
+	if err != nil {
 		return nil, err
 	}
 
-	if err = report.readJSON(zr, "build.json", &report.Build); err != nil {
+	identity := &Identity{}
+	if err = json.Unmarshal(buf, identity); err != nil {
 		return nil, err
 	}
+	return identity, nil
+}
 
-	if err = report.readJSON(zr, "system.json", &report.SysInfo); err != nil {
-		return nil, err
+// ReadAtLimits is like [ReadAt] but uses the given limits when reading entries.
+func ReadAtLimits(r io.ReaderAt, size int64, limits Limits) (report *CrashReport, err error) {
+	report = &CrashReport{
+		Build:      &debug.BuildInfo{},
+		SysInfo:    &SysInfo{},
+		Memstats:   &runtime.MemStats{},
+		Occurrence: &Occurrence{},
+		Identity:   &Identity{},
+		History:    &History{},
+		Collection: &Collection{},
+		Metadata:   &Metadata{},
+		limits:     limits.withDefaults(),
 	}
 
-	if err = report.readJSON(zr, "memstats.json", &report.Memstats); err != nil {
-		return nil, err
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		var recoverErr error
+		if zr, recoverErr = recoverZip(r, size, report.limits.Total); recoverErr != nil {
+			return nil, fmt.Errorf("unable read zip file: %w", err)
+		}
+		report.problem("zip", fmt.Errorf("the file is corrupt, recovered %d entries: %w", len(zr.File), err))
 	}
+	report.index(zr)
+
+	report.readToString("reason", &report.Reason)
+	report.readToString("stack", &report.Stack)
 
-	if report.Files, err = fs.Glob(zr, "include/*"); err != nil {
-		return nil, fmt.Errorf("Unable to get list of included files: %w", err)
+	var goroutine string
+	report.readToString("goroutine", &goroutine)
+	if goroutine != "" {
+		if report.GoroutineID, err = strconv.Atoi(strings.TrimSpace(goroutine)); err != nil {
+			report.problem("goroutine", fmt.Errorf("invalid goroutine id: %w", err))
+			report.GoroutineID = 0
+		}
 	}
 
-	// read all profiles in the zip file.
-	if err = report.readProfiles(zr); err != nil {
-		return nil, err
+	report.readJSON("build.json", &report.Build)
+	report.readJSON("system.json", &report.SysInfo)
+	report.readJSON("memstats.json", &report.Memstats)
+	report.readJSON("report.json", &report.Identity)
+	report.readJSON("occurrence.json", &report.Occurrence)
+	report.readJSON("history.json", &report.History)
+	report.readJSON("collection.json", &report.Collection)
+	report.readJSON("metadata.json", &report.Metadata)
+	report.readJSON("goroutines.json", &report.Goroutines)
+
+	// find all profiles in the zip file.
+	report.readProfiles()
+
+	if len(report.problems) != 0 {
+		report.Collection = report.Collection.clone()
+		report.Collection.Sections = append(report.Collection.Sections, report.problems...)
 	}
 
 	return report, nil
 }
 
-// readProfiles reads all profile files in the given fs
-func (c *CrashReport) readProfiles(f fs.FS) error {
-	profiles, err := fs.Glob(f, "profiles/*.prof")
+// index indexes the entries in zr.
+// Entries with names that are not valid are ignored.
+// Only the first entry with a name is used if the zip file contains duplicate entries.
+func (c *CrashReport) index(zr *zip.Reader) {
+	c.entries = make(map[string]*zip.File, len(zr.File))
+
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue // directory
+		}
+
+		if !validEntryName(f.Name) {
+			c.problem(f.Name, errors.New("invalid entry name"))
+			continue
+		}
+
+		if _, ok := c.entries[f.Name]; ok {
+			c.problem(f.Name, errors.New("duplicate entry"))
+			continue
+		}
+
+		c.entries[f.Name] = f
+		if path.Dir(f.Name) == "include" {
+			c.Files = append(c.Files, f.Name)
+		}
+	}
+
+	sort.Strings(c.Files)
+}
+
+// validEntryName checks if name is a valid name for an entry in a crash report.
+// Names must be unrooted slash separated paths that do not contain "." or ".." elements.
+func validEntryName(name string) bool {
+	return fs.ValidPath(name) && name != "." && !strings.ContainsAny(name, "\\\x00")
+}
+
+// problem records an entry that could not be read.
+func (c *CrashReport) problem(name string, err error) {
+	c.problems = append(c.problems, &Section{Name: name, Stage: StageRead, Error: err.Error()})
+}
+
+// entry returns the entry with the given name.
+// An error is returned if the entry does not exist or if it has a suspicious compression ratio.
+func (c *CrashReport) entry(name string) (*zip.File, error) {
+	f, ok := c.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("error opening file %s: %w", name, fs.ErrNotExist)
+	}
+
+	size := f.UncompressedSize64
+	if size >= minRatioSize && c.limits.Ratio >= 0 && size/(f.CompressedSize64+1) > uint64(c.limits.Ratio) {
+		return nil, fmt.Errorf("file %s exceeds the max compression ratio: size %d, compressed size %d, max ratio: %d",
+			name, size, f.CompressedSize64, c.limits.Ratio)
+	}
+
+	return f, nil
+}
+
+// Open opens a file included in the crash report.
+// name must be one of the paths in [CrashReport.Files].
+func (c *CrashReport) Open(name string) (fs.File, error) {
+	f, err := c.entry(name)
 	if err != nil {
-		return fmt.Errorf("unable to find profile files: %w", err)
+		return nil, err
 	}
 
-	for _, profileName := range profiles {
-		buf, err := c.readFile(f, profileName)
-		if err != nil {
-			return err
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &zipFile{ReadCloser: r, f: f}, nil
+}
+
+// zipFile an entry in a zip file opened using [zip.File.Open].
+type zipFile struct {
+	io.ReadCloser
+	f *zip.File
+}
+
+func (z *zipFile) Stat() (fs.FileInfo, error) { return z.f.FileInfo(), nil }
+
+// ReadFile reads a file included in the crash report.
+// name must be one of the paths in [CrashReport.Files].
+func (c *CrashReport) ReadFile(name string) ([]byte, error) {
+	return c.readFile(name, c.limits.File)
+}
+
+// readProfiles finds all profile files in the crash report.
+// The profiles are not read until they are used.
+func (c *CrashReport) readProfiles() {
+	var names []string
+	for name := range c.entries {
+		if path.Dir(name) == "profiles" && path.Ext(name) == ".prof" {
+			names = append(names, name)
 		}
+	}
+	sort.Strings(names)
 
+	for _, profileName := range names {
 		name := strings.TrimSuffix(path.Base(profileName), ".prof")
-		c.Profiles = append(c.Profiles, NewProfile(name, buf))
-	}
+		profile := NewProfile(name, nil)
+		profile.report = c
+		c.readToString("profiles/"+name+".warning", &profile.warning)
 
-	return nil
+		var display string
+		c.readToString("profiles/"+name+".name", &display)
+		if display != "" {
+			profile.name, profile.named = display, true
+		}
+		_, profile.hasText = c.entries["profiles/"+name+".txt"]
+		c.Profiles = append(c.Profiles, profile)
+	}
 }
 
 // readJSON reads and parses the given file into dst.
-// dst must be a non nil pointer to a pointer to struct (**struct)
-func (c *CrashReport) readJSON(f fs.FS, name string, dst any) error {
+// dst must be a non nil pointer to a pointer to struct (**struct) or a pointer to a slice.
+// dst is set to the zero value if the file does not exist or cannot be read.
+func (c *CrashReport) readJSON(name string, dst any) {
 	v := reflect.ValueOf(dst)
 
-	buf, err := c.readFile(f, name)
+	buf, err := c.readFile(name, c.limits.JSON)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			v.Elem().Set(reflect.Zero(v.Elem().Type()))
-			return nil
+		if !errors.Is(err, fs.ErrNotExist) {
+			c.problem(name, err)
 		}
-		return err
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+		return
 	}
 
-	err = json.Unmarshal(buf, v.Elem().Interface())
-	if err != nil {
-		return err
+	// dst may also be a pointer to a non pointer value such as a slice.
+	target := v.Elem().Interface()
+	if v.Elem().Kind() != reflect.Pointer {
+		target = dst
 	}
 
-	return nil
+	if err = json.Unmarshal(buf, target); err != nil {
+		c.problem(name, fmt.Errorf("invalid json: %w", err))
+		v.Elem().Set(reflect.Zero(v.Elem().Type()))
+	}
 }
 
 // readToString reads the given file into dst.
-func (c *CrashReport) readToString(f fs.FS, name string, dst *string) error {
-	buf, err := c.readFile(f, name)
+func (c *CrashReport) readToString(name string, dst *string) {
+	buf, err := c.readFile(name, c.limits.Text)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil
+		if !errors.Is(err, fs.ErrNotExist) {
+			c.problem(name, err)
 		}
-		return err
+		return
 	}
 
 	*dst = string(buf)
-	return nil
 }
 
-func (c *CrashReport) readFile(f fs.FS, name string) (buf []byte, err error) {
-	file, err := f.Open(name)
+// readFile reads the given file from the crash report.
+// An error is returned if the file is larger than limit bytes, unless limit is negative.
+func (c *CrashReport) readFile(name string, limit int64) (buf []byte, err error) {
+	f, err := c.entry(name)
 	if err != nil {
-		return nil, fmt.Errorf("error opening file %s: %w", name, err)
+		return nil, err
+	}
+
+	if size := f.UncompressedSize64; limit >= 0 && size > uint64(limit) {
+		return nil, fmt.Errorf("file %s exceeds max size: size %d, max: %d", name, size, limit)
 	}
 
-	stat, err := file.Stat()
+	// the size is reserved from the budget before reading the file.
+	// The zip reader returns an error if the file is larger than its recorded size.
+	release, err := c.charge(name, int64(f.UncompressedSize64))
 	if err != nil {
-		return nil, fmt.Errorf("error calling stat on %s: %w", name, err)
+		return nil, err
 	}
+	defer func() {
+		if err != nil {
+			release()
+		}
+	}()
 
-	if size := stat.Size(); size > maxSize {
-		return nil, fmt.Errorf("file %s exceeds max size: size %d, max: %d", name, size, maxSize)
+	file, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("error opening file %s: %w", name, err)
 	}
+	defer file.Close()
 
-	buf, err = io.ReadAll(file)
+	var r io.Reader = file
+	if limit >= 0 {
+		r = io.LimitReader(file, limit+1)
+	}
+
+	buf, err = io.ReadAll(r)
 	if err != nil {
 		return nil, fmt.Errorf("error reading file %s: %w", name, err)
 	}
 
-	if err = file.Close(); err != nil {
-		return nil, err
+	if limit >= 0 && int64(len(buf)) > limit {
+		return nil, fmt.Errorf("file %s exceeds max size: max: %d", name, limit)
 	}
 
 	return
 }
+
+// charge adds size to the total number of bytes read from entries.
+// Each entry is only charged once, so entries that are read again
+// when they are used do not use up the budget.
+// release removes the charge and must be called if the entry could not be read.
+func (c *CrashReport) charge(name string, size int64) (release func(), err error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	if _, ok := c.charged[name]; ok {
+		return func() {}, nil
+	}
+	if c.limits.Total >= 0 && (size < 0 || c.read+size > c.limits.Total) {
+		return nil, fmt.Errorf("file %s exceeds the total size limit of %d bytes", name, c.limits.Total)
+	}
+
+	if c.charged == nil {
+		c.charged = map[string]struct{}{}
+	}
+	c.charged[name] = struct{}{}
+	c.read += size
+	return func() {
+		c.readMu.Lock()
+		defer c.readMu.Unlock()
+		delete(c.charged, name)
+		c.read -= size
+	}, nil
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"bytes"
+	"testing"
+)
+
+// fuzzLimits limits used while fuzzing so large inputs do not exhaust memory.
+var fuzzLimits = Limits{Total: 64 << 20}
+
+// seedReport returns a crash report file used as the seed corpus.
+func seedReport(tb testing.TB) []byte {
+	tb.Helper()
+
+	return writeReport(tb, Config{
+		Reason:      []string{"seed"},
+		Profiles:    map[string]struct{}{"heap": {}, "goroutine": {}},
+		Debug:       map[string]int{"goroutine": 1},
+		Attachments: []*Attachment{{Name: "file.txt", Data: []byte("hello")}},
+	})
+}
+
+func FuzzRead(f *testing.F) {
+	seed := seedReport(f)
+	f.Add(seed)
+	f.Add(seed[:len(seed)/2])
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		report, err := ReadAtLimits(bytes.NewReader(data), int64(len(data)), fuzzLimits)
+		if err != nil {
+			return
+		}
+
+		for _, p := range report.Profiles {
+			_, _ = p.Profile()
+			_, _ = p.ReadText()
+		}
+		for _, name := range report.Files {
+			_, _ = report.ReadFile(name)
+		}
+	})
+}
+
+func FuzzProfile(f *testing.F) {
+	seed := seedReport(f)
+	report, err := ReadAtLimits(bytes.NewReader(seed), int64(len(seed)), fuzzLimits)
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, p := range report.Profiles {
+		buf, err := p.ReadProfileBytes()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf)
+	}
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, _ = NewProfile("heap", data).Profile()
+	})
+}
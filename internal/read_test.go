@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// countingReaderAt counts the bytes read from r.
+type countingReaderAt struct {
+	r *bytes.Reader
+	n int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// randomBytes returns n bytes that cannot be compressed.
+func randomBytes(t *testing.T, n int) []byte {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestReadAtLazy(t *testing.T) {
+	large := randomBytes(t, 4<<20)
+	buf := writeReport(t, Config{Attachments: []*Attachment{{Name: "large.bin", Data: large}}})
+
+	r := &countingReaderAt{r: bytes.NewReader(buf)}
+	report, err := ReadAt(r, int64(len(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&r.n); n >= 1<<20 {
+		t.Errorf("%d bytes were read before the attachment was used", n)
+	}
+
+	// entries larger than 1MB can be read using the default limits.
+	data, err := report.ReadFile(report.Files[0])
+	if err != nil || !bytes.Equal(data, large) {
+		t.Fatalf("unable to read attachment: %v", err)
+	}
+}
+
+func TestReadAtLimits(t *testing.T) {
+	buf := writeReport(t, Config{
+		Reason:      []string{strings.Repeat("x", 100)},
+		Profiles:    map[string]struct{}{"heap": {}},
+		Attachments: []*Attachment{{Name: "file.bin", Data: randomBytes(t, 1024)}},
+	})
+
+	report, err := ReadAtLimits(bytes.NewReader(buf), int64(len(buf)), Limits{Text: 10, Profile: 10, File: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Reason != "" || len(report.problems) == 0 {
+		t.Errorf("reason larger than the text limit was read: %q", report.Reason)
+	}
+
+	heap := findProfile(t, report, "heap")
+	if _, err = heap.ReadProfileBytes(); err == nil {
+		t.Error("expected an error for a profile larger than the limit")
+	}
+	if heap.ProfileBytes() != nil {
+		t.Error("ProfileBytes returned a profile larger than the limit")
+	}
+
+	if _, err = report.ReadFile(report.Files[0]); err == nil {
+		t.Error("expected an error for a file larger than the limit")
+	}
+	// files opened using Open are not limited.
+	f, err := report.Open(report.Files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// negative limits disable the limit.
+	report, err = ReadAtLimits(bytes.NewReader(buf), int64(len(buf)), Limits{File: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = report.ReadFile(report.Files[0]); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReadAtRatio(t *testing.T) {
+	// zeros compress far better than the default ratio.
+	buf := writeReport(t, Config{Attachments: []*Attachment{{Name: "zeros.bin", Data: make([]byte, 4<<20)}}})
+
+	report := readBytes(t, buf)
+	if _, err := report.ReadFile(report.Files[0]); err == nil || !strings.Contains(err.Error(), "ratio") {
+		t.Errorf("expected a compression ratio error, got %v", err)
+	}
+	if _, err := report.Open(report.Files[0]); err == nil {
+		t.Error("expected a compression ratio error when opening the file")
+	}
+
+	report, err := ReadAtLimits(bytes.NewReader(buf), int64(len(buf)), Limits{Ratio: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = report.ReadFile(report.Files[0]); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReadAtTotal(t *testing.T) {
+	buf := writeReport(t, Config{Attachments: []*Attachment{
+		{Name: "a.bin", Data: randomBytes(t, 64<<10)},
+		{Name: "b.bin", Data: randomBytes(t, 64<<10)},
+	}})
+
+	report, err := ReadAtLimits(bytes.NewReader(buf), int64(len(buf)), Limits{Total: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the small entries read by ReadAtLimits fit in the budget but both files do not.
+	report.limits.Total = report.read + 100<<10
+	if _, err = report.ReadFile(report.Files[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = report.ReadFile(report.Files[1]); err == nil {
+		t.Error("expected an error after the total limit was exceeded")
+	}
+}
+
+func TestReadAtTotalRepeated(t *testing.T) {
+	buf := writeReport(t, Config{
+		Profiles:    map[string]struct{}{"goroutine": {}},
+		Debug:       map[string]int{"goroutine": 1},
+		Attachments: []*Attachment{{Name: "a.bin", Data: randomBytes(t, 64<<10)}},
+	})
+
+	report, err := ReadAtLimits(bytes.NewReader(buf), int64(len(buf)), Limits{Total: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := findProfile(t, report, "goroutine")
+
+	// entries that are read again when they are used are only counted once.
+	for i := 0; i < 100; i++ {
+		if _, err = report.ReadFile(report.Files[0]); err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+		if _, err = profile.ReadText(); err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+	}
+}
+
+func TestReadAtTotalFailed(t *testing.T) {
+	buf := writeReport(t, Config{Attachments: []*Attachment{{Name: "a.bin", Data: randomBytes(t, 64<<10)}}})
+
+	// corrupt the attachment so reading it fails the checksum.
+	z, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range z.File {
+		if path.Base(f.Name) == "a.bin" {
+			offset, _ := f.DataOffset()
+			buf[offset+int64(f.CompressedSize64)/2] ^= 0xff
+		}
+	}
+
+	report, err := ReadAtLimits(bytes.NewReader(buf), int64(len(buf)), Limits{Total: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// entries that cannot be read are not counted.
+	read := report.read
+	if _, err = report.ReadFile(report.Files[0]); err == nil {
+		t.Fatal("expected an error for a corrupted file")
+	}
+	if report.read != read {
+		t.Errorf("failed read was counted: %d bytes, expected %d", report.read, read)
+	}
+}
+
+func TestRead(t *testing.T) {
+	buf := writeReport(t, Config{Reason: []string{"reader"}})
+	report, err := Read(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Reason != "reader" {
+		t.Errorf("unexpected reason %q", report.Reason)
+	}
+
+	identity, err := ReadIdentity(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil || identity.ID != report.Identity.ID {
+		t.Errorf("got identity %+v, %v", identity, err)
+	}
+}
@@ -0,0 +1,301 @@
+package internal
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// signatures and sizes of the zip records used when recovering a corrupt zip file.
+const (
+	localHeaderSignature     = 0x04034b50
+	dataDescriptorSignature  = 0x08074b50
+	directoryHeaderSignature = 0x02014b50
+	directoryEndSignature    = 0x06054b50
+
+	localHeaderLen     = 30
+	directoryHeaderLen = 46
+	directoryEndLen    = 22
+
+	// flagDataDescriptor is set if the sizes and crc of an entry are stored after the data.
+	flagDataDescriptor = 0x8
+)
+
+// recoveredEntry an entry recovered from the local file headers of a zip file.
+type recoveredEntry struct {
+	name             string
+	flags, method    uint16
+	modTime, modDate uint16
+	crc              uint32
+	compressed, size uint32
+	offset           int64
+}
+
+// recoverZip recovers the entries of a zip file with a missing or corrupt central directory,
+// for example because the program was killed while the crash report was being written.
+// The local file headers are scanned to find entries that can still be read, and a new central
+// directory is created for them so the result can be read using [zip.Reader].
+// At most budget bytes are decompressed while scanning, unless budget is negative.
+func recoverZip(r io.ReaderAt, size int64, budget int64) (*zip.Reader, error) {
+	var entries []*recoveredEntry
+	var end int64
+
+	offset := findSignature(r, 0, size)
+	for offset >= 0 && len(entries) < math.MaxUint16 {
+		entry, next, err := readLocalEntry(r, offset, size, &budget)
+		if err != nil {
+			offset = findSignature(r, offset+1, size)
+			continue
+		}
+
+		entries = append(entries, entry)
+		end = next
+		offset = findSignature(r, next, size)
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("no entries could be recovered")
+	}
+
+	dir := centralDirectory(entries, end)
+	return zip.NewReader(&appendReaderAt{r: r, size: end, tail: dir}, end+int64(len(dir)))
+}
+
+// findSignature returns the offset of the first local file header at or after offset.
+// -1 is returned if there are no more local file headers.
+func findSignature(r io.ReaderAt, offset, size int64) int64 {
+	var sig [4]byte
+	binary.LittleEndian.PutUint32(sig[:], localHeaderSignature)
+
+	buf := make([]byte, 64*1024)
+	for offset < size {
+		n, err := r.ReadAt(buf, offset)
+		if n < len(sig) {
+			return -1
+		}
+
+		if i := bytes.Index(buf[:n], sig[:]); i >= 0 {
+			return offset + int64(i)
+		}
+
+		if err != nil {
+			return -1
+		}
+		// the signature may cross the end of buf.
+		offset += int64(n - len(sig) + 1)
+	}
+	return -1
+}
+
+// readLocalEntry reads the entry with the local file header at offset.
+// The data of the entry is decompressed to find its size and verify its checksum.
+// The offset of the end of the entry is returned.
+func readLocalEntry(r io.ReaderAt, offset, size int64, budget *int64) (*recoveredEntry, int64, error) {
+	var header [localHeaderLen]byte
+	if _, err := r.ReadAt(header[:], offset); err != nil {
+		return nil, 0, err
+	}
+
+	b := header[:]
+	if binary.LittleEndian.Uint32(b) != localHeaderSignature {
+		return nil, 0, zip.ErrFormat
+	}
+
+	e := &recoveredEntry{
+		offset:     offset,
+		flags:      binary.LittleEndian.Uint16(b[6:]),
+		method:     binary.LittleEndian.Uint16(b[8:]),
+		modTime:    binary.LittleEndian.Uint16(b[10:]),
+		modDate:    binary.LittleEndian.Uint16(b[12:]),
+		crc:        binary.LittleEndian.Uint32(b[14:]),
+		compressed: binary.LittleEndian.Uint32(b[18:]),
+		size:       binary.LittleEndian.Uint32(b[22:]),
+	}
+	nameLen := int64(binary.LittleEndian.Uint16(b[26:]))
+	extraLen := int64(binary.LittleEndian.Uint16(b[28:]))
+
+	name := make([]byte, nameLen)
+	if _, err := r.ReadAt(name, offset+localHeaderLen); err != nil {
+		return nil, 0, err
+	}
+	e.name = string(name)
+
+	dataOffset := offset + localHeaderLen + nameLen + extraLen
+	if dataOffset > size {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	data := &countingReader{r: bufio.NewReader(io.NewSectionReader(r, dataOffset, size-dataOffset))}
+	var content io.Reader
+	switch e.method {
+	case zip.Deflate:
+		content = flate.NewReader(data)
+	case zip.Store:
+		if e.flags&flagDataDescriptor != 0 {
+			return nil, 0, errors.New("unable to find the end of a stored entry")
+		}
+		content = io.LimitReader(data, int64(e.compressed))
+	default:
+		return nil, 0, zip.ErrAlgorithm
+	}
+
+	limit := int64(math.MaxUint32)
+	if *budget >= 0 && *budget < limit {
+		limit = *budget
+	}
+
+	hash := crc32.NewIEEE()
+	n, err := io.Copy(hash, io.LimitReader(content, limit+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if n > limit {
+		return nil, 0, errors.New("entry is too large")
+	}
+	if *budget >= 0 {
+		*budget -= n
+	}
+
+	crc, compressed, uncompressed := hash.Sum32(), data.n, uint32(n)
+	if compressed > math.MaxUint32 {
+		return nil, 0, errors.New("entry is too large")
+	}
+
+	end := dataOffset + compressed
+	if e.flags&flagDataDescriptor != 0 {
+		var desc [16]byte
+		n, _ := r.ReadAt(desc[:], end)
+
+		// the signature of the data descriptor is optional.
+		d := desc[:n]
+		if len(d) >= 4 && binary.LittleEndian.Uint32(d) == dataDescriptorSignature {
+			d = d[4:]
+			end += 4
+		}
+		if len(d) < 12 {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		e.crc = binary.LittleEndian.Uint32(d)
+		e.compressed = binary.LittleEndian.Uint32(d[4:])
+		e.size = binary.LittleEndian.Uint32(d[8:])
+		end += 12
+	}
+
+	if e.crc != crc || int64(e.compressed) != compressed || e.size != uncompressed {
+		return nil, 0, zip.ErrChecksum
+	}
+
+	// the central directory does not use zip64 records.
+	if end > math.MaxUint32 {
+		return nil, 0, errors.New("entry offset is too large")
+	}
+
+	e.flags &^= flagDataDescriptor
+	return e, end, nil
+}
+
+// centralDirectory creates the central directory for the given entries.
+// offset is the offset the central directory will be written to.
+func centralDirectory(entries []*recoveredEntry, offset int64) []byte {
+	var buf bytes.Buffer
+	le := binary.LittleEndian
+
+	for _, e := range entries {
+		var h [directoryHeaderLen]byte
+		le.PutUint32(h[0:], directoryHeaderSignature)
+		le.PutUint16(h[4:], 20) // version made by
+		le.PutUint16(h[6:], 20) // version needed to extract
+		le.PutUint16(h[8:], e.flags)
+		le.PutUint16(h[10:], e.method)
+		le.PutUint16(h[12:], e.modTime)
+		le.PutUint16(h[14:], e.modDate)
+		le.PutUint32(h[16:], e.crc)
+		le.PutUint32(h[20:], e.compressed)
+		le.PutUint32(h[24:], e.size)
+		le.PutUint16(h[28:], uint16(len(e.name)))
+		le.PutUint32(h[42:], uint32(e.offset))
+		buf.Write(h[:])
+		buf.WriteString(e.name)
+	}
+
+	var end [directoryEndLen]byte
+	le.PutUint32(end[0:], directoryEndSignature)
+	le.PutUint16(end[8:], uint16(len(entries)))
+	le.PutUint16(end[10:], uint16(len(entries)))
+	le.PutUint32(end[12:], uint32(buf.Len()))
+	le.PutUint32(end[16:], uint32(offset))
+	buf.Write(end[:])
+
+	return buf.Bytes()
+}
+
+// countingReader counts the number of bytes read from r.
+// It implements [io.ByteReader] so [flate.NewReader] does not read past the end of the compressed data.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// appendReaderAt a [io.ReaderAt] that reads the first size bytes of r followed by tail.
+type appendReaderAt struct {
+	r    io.ReaderAt
+	size int64
+	tail []byte
+}
+
+func (a *appendReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+
+	if off < a.size {
+		end := int64(len(p))
+		if remaining := a.size - off; end > remaining {
+			end = remaining
+		}
+
+		n, err = a.r.ReadAt(p[:end], off)
+		if int64(n) < end {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+		if n == len(p) {
+			return n, nil
+		}
+		off += int64(n)
+	}
+
+	tailOffset := off - a.size
+	if tailOffset >= int64(len(a.tail)) {
+		return n, io.EOF
+	}
+
+	n += copy(p[n:], a.tail[tailOffset:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// zipEntry an entry written by writeZip.
+type zipEntry struct{ name, data string }
+
+// writeZip writes a crash report file containing the given entries.
+// Unlike [zip.Writer.Create] duplicate and invalid names are written as is.
+func writeZip(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	buf.WriteString(Header)
+	zw := zip.NewWriter(&buf)
+	zw.SetOffset(int64(buf.Len()))
+	for _, e := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// hasProblem checks if reading report recorded a problem for the given entry.
+func hasProblem(report *CrashReport, name string) bool {
+	for _, p := range report.problems {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReadInvalidEntries(t *testing.T) {
+	report := readBytes(t, writeZip(t,
+		zipEntry{"reason", "first"},
+		zipEntry{"reason", "second"},
+		zipEntry{"include/../../evil", "evil"},
+		zipEntry{"include/ok.txt", "ok"},
+		zipEntry{"memstats.json", "{not json"},
+		zipEntry{"profiles/heap.prof", "not a profile"},
+	))
+
+	if report.Reason != "first" || !hasProblem(report, "reason") {
+		t.Errorf("duplicate entry was not handled: %q %v", report.Reason, report.problems)
+	}
+	if !hasProblem(report, "include/../../evil") {
+		t.Error("entry with an invalid name was not reported")
+	}
+	if len(report.Files) != 1 || report.Files[0] != "include/ok.txt" {
+		t.Errorf("unexpected files %v", report.Files)
+	}
+	if !hasProblem(report, "memstats.json") || report.Memstats != nil {
+		t.Errorf("invalid json was not reported: %v", report.problems)
+	}
+
+	// the problems are included in the collection shown by the viewer.
+	if len(report.Collection.Problems()) != len(report.problems) {
+		t.Error("problems were not added to the collection")
+	}
+
+	heap := findProfile(t, report, "heap")
+	if _, err := heap.Profile(); err == nil {
+		t.Error("expected an error for an invalid profile")
+	}
+}
+
+func TestReadTruncated(t *testing.T) {
+	buf := writeReport(t, Config{
+		Reason:      []string{"truncated"},
+		Attachments: []*Attachment{{Name: "log.txt", Data: []byte("log output")}},
+	})
+
+	// the central directory is written last, so it is lost if the process is killed while writing.
+	zr, err := zip.NewReader(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dataEnd int64
+	for _, f := range zr.File {
+		offset, err := f.DataOffset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if end := offset + int64(f.CompressedSize64); end > dataEnd {
+			dataEnd = end
+		}
+	}
+	end := int(dataEnd) + bytes.Index(buf[dataEnd:], []byte("PK\x01\x02"))
+
+	report := readBytes(t, buf[:end])
+	if !hasProblem(report, "zip") {
+		t.Error("the corrupt file was not reported")
+	}
+	if report.Reason != "truncated" || !strings.Contains(report.Stack, "goroutine ") {
+		t.Errorf("entries were not recovered: %q", report.Reason)
+	}
+	if len(report.Files) != 1 {
+		t.Fatalf("unexpected files %v", report.Files)
+	}
+	if data, err := report.ReadFile(report.Files[0]); err != nil || string(data) != "log output" {
+		t.Errorf("got %q, %v", data, err)
+	}
+
+	// a file that was cut off in the middle of an entry keeps the entries before it.
+	report = readBytes(t, buf[:end-10])
+	if report.Reason != "truncated" {
+		t.Errorf("entries before the truncated entry were not recovered: %q", report.Reason)
+	}
+}
+
+func TestReadNotAReport(t *testing.T) {
+	data := []byte("not a crash report")
+	if _, err := ReadAt(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("expected an error")
+	}
+}
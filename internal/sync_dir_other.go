@@ -0,0 +1,19 @@
+//go:build !windows
+
+package internal
+
+import "os"
+
+// SyncDir syncs the given directory so entries that were created or renamed in it are not lost on power loss.
+func SyncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	err = f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DataDog/gostackparse"
+)
+
+// WriteText writes a text rendering of the crash report to w.
+// Every line except the crashing stack starts with "crashreport:" followed by a key,
+// so the rendering can be found in logs using grep.
+func (c *CrashReport) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	line := func(key, format string, args ...any) {
+		fmt.Fprintf(bw, "crashreport: %-12s %s\n", key+":", fmt.Sprintf(format, args...))
+	}
+
+	if i := c.Identity; i != nil && i.ID != "" {
+		report := []string{"id=" + i.ID}
+		if i.Service != "" {
+			report = append(report, "service="+i.Service)
+		}
+		if i.Instance != "" {
+			report = append(report, "instance="+i.Instance)
+		}
+		if i.Hostname != "" {
+			report = append(report, "host="+i.Hostname)
+		}
+		if i.PID != 0 {
+			report = append(report, "pid="+strconv.Itoa(i.PID))
+		}
+		if !i.ProcessStart.IsZero() {
+			report = append(report, "process_start="+i.ProcessStart.Format(time.RFC3339))
+		}
+		line("report", "%s", strings.Join(report, " "))
+	}
+
+	if reason := strings.TrimSpace(c.Reason); reason != "" {
+		for _, l := range strings.Split(reason, "\n") {
+			line("reason", "%s", l)
+		}
+	}
+
+	if c.Occurrence != nil && c.Occurrence.Fingerprint != "" {
+		line("fingerprint", "%s suppressed=%d", c.Occurrence.Fingerprint, c.Occurrence.Suppressed)
+	}
+
+	if h := c.History; h != nil && len(h.Crashes) != 0 {
+		last := h.Last()
+		line("history", "crashes=%d window=%s last=%s last_fingerprint=%s", h.Count, h.Window, last.Time.Format(time.RFC3339), last.Fingerprint)
+	}
+
+	if b := c.Build; b != nil && (b.GoVersion != "" || b.Path != "") {
+		build := []string{"path=" + b.Path, "version=" + b.Main.Version, "go=" + b.GoVersion}
+		for _, s := range b.Settings {
+			if strings.HasPrefix(s.Key, "vcs") {
+				build = append(build, s.Key+"="+s.Value)
+			}
+		}
+		line("build", "%s", strings.Join(build, " "))
+	}
+
+	if s := c.SysInfo; s != nil && s.OS != "" {
+		line("time", "%s", s.Time.Format(time.RFC3339))
+		line("system", "os=%s arch=%s go=%s cpus=%d gomaxprocs=%d goroutines=%d threads=%d uptime=%s",
+			s.OS, s.Arch, s.GoVersion, s.CPU, s.MaxCPU, s.Goroutines, s.Threads, s.TimeRunning.Round(time.Second))
+	}
+
+	if m := c.Memstats; m != nil && m.Sys != 0 {
+		line("memory", "heap_alloc=%s heap_inuse=%s heap_objects=%d stack_inuse=%s sys=%s num_gc=%d gc_pause_total=%s",
+			formatBytes(m.HeapAlloc), formatBytes(m.HeapInuse), m.HeapObjects, formatBytes(m.StackInuse),
+			formatBytes(m.Sys), m.NumGC, time.Duration(m.PauseTotalNs))
+	}
+
+	if c.Metadata != nil {
+		for _, k := range sortedKeys(c.Metadata.Values) {
+			line("metadata", "%s=%s", k, c.Metadata.Values[k])
+		}
+		for _, k := range sortedKeys(c.Metadata.Labels) {
+			line("label", "%s=%s", k, c.Metadata.Labels[k])
+		}
+	}
+
+	for _, p := range c.Collection.Problems() {
+		line("problem", "%s %s: %s", p.Stage, p.Name, p.Error)
+	}
+
+	goroutines := c.Goroutines
+	if goroutines == nil && c.Stack != "" {
+		goroutines, _ = gostackparse.Parse(strings.NewReader(c.Stack))
+	}
+	if len(goroutines) != 0 {
+		line("goroutines", "%d", len(goroutines))
+		for _, g := range groupGoroutines(goroutines) {
+			line("goroutines", "%6d [%s] %s", g.count, g.state, g.function)
+		}
+	}
+
+	if c.Stack != "" {
+		line("stack", "goroutine %d", c.GoroutineID)
+		fmt.Fprintf(bw, "%s\n\n", strings.TrimSpace(goroutineStack(c.Stack, c.GoroutineID)))
+	}
+
+	return bw.Flush()
+}
+
+// goroutineGroup goroutines with the same state and function.
+type goroutineGroup struct {
+	state    string
+	function string
+	count    int
+}
+
+// groupGoroutines groups goroutines by their state and the first function in
+// their stack that is not part of the runtime or this module.
+// The groups are sorted by the number of goroutines in each group.
+func groupGoroutines(goroutines []*gostackparse.Goroutine) []*goroutineGroup {
+	groups := map[string]*goroutineGroup{}
+	for _, g := range goroutines {
+		function := "unknown"
+		for _, frame := range g.Stack {
+			function = frame.Func
+			if !strings.HasPrefix(frame.Func, "runtime.") && !strings.HasPrefix(frame.Func, "sync.") && !isInternalFrame(frame.Func) {
+				break
+			}
+		}
+
+		key := g.State + "\x00" + function
+		if groups[key] == nil {
+			groups[key] = &goroutineGroup{state: g.State, function: function}
+		}
+		groups[key].count++
+	}
+
+	sorted := make([]*goroutineGroup, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].function < sorted[j].function
+	})
+	return sorted
+}
+
+// formatBytes formats n using binary units.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatUint(n, 10) + "B"
+	}
+
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return strconv.FormatFloat(float64(n)/float64(div), 'f', 1, 64) + string("KMGTPE"[exp]) + "iB"
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DataDog/gostackparse"
+)
+
+func TestWriteText(t *testing.T) {
+	stack := "goroutine 1 [chan receive]:\nmain.main()\n\t/src/main.go:10 +0x30\n\n" +
+		"goroutine 7 [running]:\nmain.crash()\n\t/src/main.go:5 +0x25\n"
+
+	report := roundTrip(t, Config{Reason: []string{"first", "second"}, Metadata: Metadata{Values: map[string]string{"k": "v"}}})
+	report.Stack, report.Goroutines, report.GoroutineID = stack, nil, 7
+
+	var b strings.Builder
+	if err := report.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	text := b.String()
+
+	for _, expected := range []string{
+		"crashreport: report:      id=" + report.Identity.ID,
+		"crashreport: reason:      first\ncrashreport: reason:      second\n",
+		"crashreport: build:",
+		"crashreport: system:",
+		"crashreport: memory:",
+		"crashreport: metadata:    k=v\n",
+		"crashreport: goroutines:  2\n",
+		"crashreport: stack:       goroutine 7\ngoroutine 7 [running]:\nmain.crash()",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("text does not contain %q:\n%s", expected, text)
+		}
+	}
+
+	// only the crashing goroutine is included in full.
+	if strings.Contains(text, "/src/main.go:10") {
+		t.Errorf("text contains the stack of other goroutines:\n%s", text)
+	}
+}
+
+func TestGroupGoroutines(t *testing.T) {
+	stack := "goroutine 1 [select]:\nruntime.gopark()\n\t/go/proc.go:1 +0x1\nmain.worker()\n\t/src/main.go:1 +0x1\n\n" +
+		"goroutine 2 [select]:\nruntime.gopark()\n\t/go/proc.go:1 +0x1\nmain.worker()\n\t/src/main.go:1 +0x1\n\n" +
+		"goroutine 3 [running]:\nmain.main()\n\t/src/main.go:2 +0x1\n"
+	goroutines, errs := gostackparse.Parse(strings.NewReader(stack))
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	groups := groupGoroutines(goroutines)
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(groups))
+	}
+	if g := groups[0]; g.count != 2 || g.state != "select" || g.function != "main.worker" {
+		t.Errorf("unexpected group %+v", g)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, expected := range map[uint64]string{0: "0B", 1023: "1023B", 1024: "1.0KiB", 3 << 20: "3.0MiB", 5 << 30: "5.0GiB"} {
+		if s := formatBytes(n); s != expected {
+			t.Errorf("%d: got %q, expected %q", n, s, expected)
+		}
+	}
+}
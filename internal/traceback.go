@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/DataDog/gostackparse"
+)
+
+// tracebackPrefixes the prefixes of the first line of a Go traceback.
+var tracebackPrefixes = []string{"panic: ", "fatal error: ", "runtime: ", "unexpected fault address", "SIGQUIT: "}
+
+// goroutineHeader matches goroutine headers printed with GOTRACEBACK=system or higher.
+// For example "goroutine 6 gp=0xc000002380 m=0 mp=0x56f320 [running]:".
+var goroutineHeader = regexp.MustCompile(`(?m)^goroutine (\d+)(?: gp=\S+)?(?: m=\S+)?(?: mp=\S+)? \[`)
+
+// normalizeStack rewrites goroutine headers to the format printed by the default
+// GOTRACEBACK setting so they can be parsed.
+func normalizeStack(stack string) string {
+	return goroutineHeader.ReplaceAllString(stack, "goroutine $1 [")
+}
+
+// IsTracebackStart checks if line is the first line of a traceback printed by the go runtime.
+func IsTracebackStart(line string) bool {
+	for _, prefix := range tracebackPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTraceback parses the traceback printed by a Go program that panicked
+// or encountered a fatal error. Any text before the traceback is ignored.
+// The reason contains every line before the first goroutine, including
+// nested panics and [recovered] markers.
+func ParseTraceback(text string) (*CrashReport, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+
+	start := -1
+	for i, line := range lines {
+		if IsTracebackStart(line) {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		return nil, errors.New("no panic or fatal error found")
+	}
+
+	stackStart := len(lines)
+	for i := start; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], "goroutine ") && strings.HasSuffix(lines[i], ":") {
+			stackStart = i
+			break
+		}
+	}
+
+	// drop trailing output that is not part of the stack, like "exit status 2".
+	end := len(lines)
+	for end > stackStart {
+		line := lines[end-1]
+		if strings.HasPrefix(line, "\t") || line == "...additional frames elided..." {
+			break
+		}
+		end--
+	}
+
+	cr := &CrashReport{
+		Reason:     strings.TrimSpace(strings.Join(lines[start:stackStart], "\n")),
+		Stack:      strings.TrimRight(strings.Join(lines[stackStart:end], "\n"), "\n") + "\n",
+		Collection: &Collection{},
+		// the process that crashed is not known, so only the id is set.
+		Identity: &Identity{ID: NewID()},
+	}
+
+	goroutines, errs := gostackparse.Parse(strings.NewReader(normalizeStack(cr.Stack)))
+	for _, err := range errs {
+		cr.Collection.add(StageCollect, "goroutines", 0, false, err)
+	}
+
+	for _, g := range goroutines {
+		for ; g != nil; g = g.Ancestor {
+			if g.CreatedBy != nil {
+				// since go1.21 the id of the creating goroutine is included.
+				g.CreatedBy.Func, _, _ = strings.Cut(g.CreatedBy.Func, " in goroutine ")
+			}
+		}
+	}
+	cr.Goroutines = goroutines
+
+	// the runtime prints the goroutine that crashed first.
+	if len(goroutines) != 0 {
+		cr.GoroutineID = goroutines[0].ID
+		cr.Occurrence = &Occurrence{Fingerprint: Fingerprint(normalizeStack(cr.Stack), cr.GoroutineID)}
+	}
+
+	return cr, nil
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+const testTraceback = `2024/01/01 12:00:00 starting server
+panic: first [recovered]
+	panic: second
+
+goroutine 7 gp=0xc000002380 m=0 mp=0x56f320 [running]:
+main.handle(...)
+	/src/main.go:12 +0x25
+main.serve()
+	/src/main.go:20 +0x3a
+created by main.main in goroutine 1
+	/src/main.go:30 +0x45
+
+goroutine 1 [chan receive]:
+main.main()
+	/src/main.go:31 +0x50
+exit status 2
+`
+
+func TestParseTraceback(t *testing.T) {
+	report, err := ParseTraceback(strings.ReplaceAll(testTraceback, "\n", "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "panic: first [recovered]\n\tpanic: second"; report.Reason != expected {
+		t.Errorf("got reason %q, expected %q", report.Reason, expected)
+	}
+	if strings.Contains(report.Stack, "exit status") || strings.Contains(report.Stack, "starting server") {
+		t.Errorf("stack contains output that is not part of the traceback:\n%s", report.Stack)
+	}
+
+	if len(report.Goroutines) != 2 {
+		t.Fatalf("expected 2 goroutines, got %d: %v", len(report.Goroutines), report.Collection.Problems())
+	}
+	if report.GoroutineID != 7 {
+		t.Errorf("expected the crashing goroutine to be 7, got %d", report.GoroutineID)
+	}
+	if created := report.Goroutines[0].CreatedBy; created == nil || created.Func != "main.main" {
+		t.Errorf("unexpected created by %+v", created)
+	}
+	if report.Occurrence == nil || report.Occurrence.Fingerprint == "" {
+		t.Error("fingerprint was not computed")
+	}
+	if report.Identity == nil || len(report.Identity.ID) != 26 {
+		t.Errorf("report has no id: %+v", report.Identity)
+	}
+}
+
+func TestParseTracebackFatalError(t *testing.T) {
+	text := "runtime: out of memory: cannot allocate 1024-byte block\nfatal error: out of memory\n\ngoroutine 1 [running]:\nmain.main()\n\t/src/main.go:5 +0x25\n"
+	report, err := ParseTraceback(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(report.Reason, "runtime: out of memory") || !strings.HasSuffix(report.Reason, "fatal error: out of memory") {
+		t.Errorf("unexpected reason %q", report.Reason)
+	}
+}
+
+func TestParseTracebackMissing(t *testing.T) {
+	if _, err := ParseTraceback("just some log output\n"); err == nil {
+		t.Error("expected an error for output without a traceback")
+	}
+}
@@ -51,9 +51,41 @@ type page struct {
 
 var upgrader = websocket.Upgrader{EnableCompression: false}
 
-// Run runs the web ui
-func Run(r io.Reader, port int, openBrowser bool) error {
-	data, err := internal.Read(r)
+// stackPage the data used to render the stack trace page.
+type stackPage struct {
+	*internal.CrashReport
+
+	// Crashing the goroutine that crashed. This is nil if it is unknown.
+	Crashing *internal.GoroutineStack
+	// Others every other goroutine.
+	Others []*internal.GoroutineStack
+}
+
+func newStackPage(data *internal.CrashReport) *stackPage {
+	p := &stackPage{CrashReport: data}
+	if data.GoroutineID == 0 {
+		return p
+	}
+
+	goroutines := internal.SplitStack(data.Stack)
+	for _, g := range goroutines {
+		if g.ID == data.GoroutineID && p.Crashing == nil {
+			p.Crashing = g
+		} else {
+			p.Others = append(p.Others, g)
+		}
+	}
+
+	if p.Crashing == nil {
+		p.Others = nil
+	}
+	return p
+}
+
+// Run runs the web ui for the crash report r with the given size.
+// Profiles and included files are read from r when they are viewed.
+func Run(r io.ReaderAt, size int64, port int, openBrowser bool) error {
+	data, err := internal.ReadAt(r, size)
 	if err != nil {
 		return err
 	}
@@ -100,6 +132,69 @@ func (u *UI) serveStatic(name, templateName, url string, data any) error {
 	return nil
 }
 
+// serveTemplate serves a page that is rendered every time it is requested.
+// This is used for pages that are too large to be kept in memory.
+func (u *UI) serveTemplate(name, templateName, url string, data any) error {
+	tmp := Template.Lookup(templateName)
+	if tmp == nil {
+		return fmt.Errorf("template %s does not exist", templateName)
+	}
+
+	u.serveMux.HandleFunc(url, func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := tmp.Execute(&buf, data); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			u.logHTTPErr(r, err)
+			return
+		}
+
+		_, err := w.Write(buf.Bytes())
+		u.logHTTPErr(r, err)
+	})
+
+	u.pages = append(u.pages, &page{name, template.URL(url), strings.ToLower(name)})
+
+	return nil
+}
+
+// serveFile serves a file included in the crash report without reading the whole file into memory.
+func (u *UI) serveFile(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	f, err := u.crashReport.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, err = io.Copy(w, f)
+	u.logHTTPErr(r, err)
+}
+
+// lazyProfile registers the handlers for a profile the first time it is viewed,
+// so a profile is only read from the crash report if it is used.
+type lazyProfile struct {
+	prof *internal.Profile
+
+	once sync.Once
+	mux  *http.ServeMux
+	err  error
+}
+
+func (l *lazyProfile) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.once.Do(func() {
+		l.mux = http.NewServeMux()
+		l.err = l.prof.Register(l.mux)
+	})
+
+	if l.err != nil {
+		http.Error(w, fmt.Sprintf("Unable to read profile %s: %s", l.prof.Name(), l.err), http.StatusInternalServerError)
+		return
+	}
+	l.mux.ServeHTTP(w, r)
+}
+
 func (u *UI) logHTTPErr(r *http.Request, err error) {
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error serving request %s: %s", r.URL, err)
@@ -112,16 +207,26 @@ func (u *UI) Init(data *internal.CrashReport) error {
 	u.serveMux = mux
 
 	for _, prof := range data.Profiles {
-		err := prof.Register(mux)
-		if err != nil {
-			return err
+		if prof.Warning() != "" {
+			if err := u.serveStatic(prof.Name(), "warning.html", "/profile/"+prof.URL()+"/", prof); err != nil {
+				return err
+			}
+			continue
 		}
 
+		mux.Handle("/profile/"+prof.URL()+"/", &lazyProfile{prof: prof})
+
 		u.pages = append(u.pages, &page{prof.Name(), template.URL("/profile/" + prof.URL()), prof.URL()})
+
+		if prof.HasText() {
+			if err := u.serveTemplate(prof.Name()+" (text)", "text.html", "/text/"+prof.URL(), prof); err != nil {
+				return err
+			}
+		}
 	}
 
 	if len(data.Stack) != 0 || len(data.Reason) != 0 {
-		if err := u.serveStatic("Stack Trace", "stack.html", "/stacktrace", data); err != nil {
+		if err := u.serveStatic("Stack Trace", "stack.html", "/stacktrace", newStackPage(data)); err != nil {
 			return err
 		}
 	}
@@ -132,12 +237,31 @@ func (u *UI) Init(data *internal.CrashReport) error {
 		}
 	}
 
+	if !data.Metadata.Empty() {
+		if err := u.serveStatic("Metadata", "metadata.html", "/metadata", data.Metadata); err != nil {
+			return err
+		}
+	}
+
 	if data.Memstats != nil {
 		if err := u.serveStatic("Memory", "mem.html", "/memory", data.Memstats); err != nil {
 			return err
 		}
 	}
 
+	if len(data.Files) != 0 {
+		mux.HandleFunc("/include/", u.serveFile)
+		if err := u.serveStatic("Files", "files.html", "/files", data.Files); err != nil {
+			return err
+		}
+	}
+
+	if len(data.Collection.Problems()) != 0 {
+		if err := u.serveStatic("Collection Problems", "collection.html", "/collection", data.Collection); err != nil {
+			return err
+		}
+	}
+
 	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
 		err := Template.Lookup("main.html").Execute(w, u.pages)
 		u.logHTTPErr(req, err)
@@ -0,0 +1,36 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/yehan2002/crashreport/internal"
+)
+
+const testStack = `goroutine 1 [chan receive]:
+main.main()
+	/src/main.go:10 +0x30
+
+goroutine 7 [running]:
+main.crash()
+	/src/main.go:5 +0x25
+
+goroutine 8 [sleep]:
+time.Sleep()
+`
+
+func TestNewStackPage(t *testing.T) {
+	p := newStackPage(&internal.CrashReport{Stack: testStack, GoroutineID: 7})
+	if p.Crashing == nil || p.Crashing.ID != 7 {
+		t.Fatalf("crashing goroutine was not found: %+v", p.Crashing)
+	}
+	if len(p.Others) != 2 || p.Others[0].ID != 1 || p.Others[1].ID != 8 {
+		t.Errorf("unexpected other goroutines %+v", p.Others)
+	}
+
+	// the stack is shown as is if the crashing goroutine is unknown or missing.
+	for _, id := range []int{0, 99} {
+		if p = newStackPage(&internal.CrashReport{Stack: testStack, GoroutineID: id}); p.Crashing != nil || p.Others != nil {
+			t.Errorf("goroutine %d: expected no split, got %+v %+v", id, p.Crashing, p.Others)
+		}
+	}
+}
@@ -3,18 +3,27 @@ package internal
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"runtime"
+	"runtime/debug"
 	"runtime/pprof"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Header the header line to be used a crash report file.
-// This text is written before the contents of the crash report
+// This text is written before the contents of the crash report,
+// followed by the id of the report and the process that wrote it. See [Identity].
 var Header = `crashreport
 Use github.com/yehan2002/crashreport or open this file with any zip file viewer.
 `
@@ -45,6 +54,17 @@ func (p Profiles) Add(c *Config) {
 	}
 }
 
+// AddDebug adds the profiles to the config and sets the debug level used
+// for the text form of each profile.
+func (p Profiles) AddDebug(c *Config, debug int) {
+	for i := 0; i < len(profiles); i++ {
+		if p&0x1 == 1 {
+			c.SetDebug(profiles[i], debug)
+		}
+		p = p >> 1
+	}
+}
+
 // Config a struct containing config for creating a crash report.
 type Config struct {
 	Reason []string
@@ -52,81 +72,352 @@ type Config struct {
 	NoStack   bool
 	NoSysInfo bool
 
-	Profiles map[string]struct{}
-	Files    []string
+	Profiles    map[string]struct{}
+	Files       []string
+	Attachments []*Attachment
+
+	// Debug the debug levels for profiles that should also be included in text form.
+	// See [pprof.Profile.WriteTo].
+	Debug map[string]int
+
+	// Delta includes the difference between the current heap, allocs, block and mutex
+	// profiles and the baseline recorded by [TakeBaseline].
+	Delta bool
+
+	// Metadata extra information included in the report.
+	Metadata Metadata
+
+	// GoroutineID the id of the goroutine that crashed.
+	// Defaults to the goroutine calling [CreateContext].
+	GoroutineID int
+
+	// SectionTimeout the maximum amount of time spent on a single section
+	// when creating or writing the report. Zero means no limit.
+	SectionTimeout time.Duration
+
+	// Occurrence is included in the report if it is not nil.
+	// Otherwise a fingerprint is computed from the stack.
+	Occurrence *Occurrence
+
+	// History is included in the report if it is not nil.
+	History *History
+
+	// Identity identifies the report. A new identity is created if it is nil.
+	Identity *Identity
+
+	// Custom profiles that are used instead of the profiles registered with the same name.
+	// The profiles must also be included in Profiles.
+	Custom map[string]*CustomProfile
+
+	// Warnings problems with the config that are included in the report.
+	Warnings []*Section
+}
+
+// CustomProfile a profile that is not looked up using [pprof.Lookup].
+type CustomProfile struct {
+	Profile *pprof.Profile
+	// Name the name of the profile shown in the viewer. Defaults to the name of the profile.
+	Name string
+}
+
+// SetDebug includes the given profile and sets the debug level used for its text form.
+// A debug level of zero only includes the protobuf form.
+func (c *Config) SetDebug(profile string, debug int) {
+	c.Profiles[profile] = struct{}{}
+	if c.Debug == nil {
+		c.Debug = map[string]int{}
+	}
+	if debug <= 0 {
+		delete(c.Debug, profile)
+		return
+	}
+	c.Debug[profile] = debug
+}
+
+// CheckProfiles returns the names of the profiles in c that can be collected in sorted order,
+// and the problems with the other profiles. Profiles are looked up every time this is called,
+// so profiles registered after they were added to c are found.
+// Profiles are not collected if they are not registered, or if their file name in the report
+// is already used by another profile. See [profileFile].
+func (c *Config) CheckProfiles() (names []string, problems []*Section) {
+	all := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		all = append(all, name)
+	}
+	sort.Strings(all)
+
+	problem := func(name, format string, args ...any) {
+		problems = append(problems, &Section{Name: "profiles/" + name, Stage: StageConfig, Error: fmt.Sprintf(format, args...)})
+	}
+
+	// files the name of the profile each file name is used by.
+	files := map[string]string{}
+	for _, name := range all {
+		if prof, _ := c.lookup(name); prof == nil {
+			problem(name, "unknown profile %q", name)
+			continue
+		}
+
+		file := profileFile(name)
+		if other, ok := files[file]; ok {
+			problem(name, "profile %q is stored as %s which is already used by profile %q", name, file, other)
+			continue
+		}
+		files[file] = name
+
+		if c.Delta && isBaselineProfile(name) {
+			files[file+deltaSuffix] = name + deltaSuffix
+		}
+		names = append(names, name)
+	}
+
+	return names, problems
+}
+
+// lookup returns the profile with the given name and the name shown in the viewer.
+// nil is returned if the profile does not exist.
+func (c *Config) lookup(name string) (*pprof.Profile, string) {
+	if custom := c.Custom[name]; custom != nil {
+		return custom.Profile, custom.Name
+	}
+	return pprof.Lookup(name), ""
 }
 
+// Create creates a crash report using the given config.
+// Collection is best-effort: errors collecting a section are recorded in
+// [CrashReport.Collection] and the rest of the report is still created.
 func Create(c Config) (*CrashReport, error) {
+	return CreateContext(context.Background(), c)
+}
+
+// CreateContext creates a crash report using the given config.
+// Sections that do not finish before ctx is done or [Config.SectionTimeout]
+// expires are skipped and marked as timed out.
+func CreateContext(ctx context.Context, c Config) (*CrashReport, error) {
 	cr := CrashReport{
-		Reason: strings.Join(c.Reason, "\n"),
-		Files:  c.Files,
+		Reason:         strings.Join(c.Reason, "\n"),
+		Files:          c.Files,
+		Attachments:    c.Attachments,
+		Collection:     &Collection{},
+		Metadata:       c.Metadata.clone(),
+		sectionTimeout: c.SectionTimeout,
+	}
+	col := cr.Collection
+	timeout := c.SectionTimeout
+
+	for _, w := range c.Warnings {
+		s := *w
+		col.Sections = append(col.Sections, &s)
+	}
+
+	// sections run in their own goroutines, so the id must be read here.
+	if cr.GoroutineID = c.GoroutineID; cr.GoroutineID == 0 {
+		cr.GoroutineID = CurrentGoroutineID()
 	}
 
 	var mem runtime.MemStats
-	runtime.ReadMemStats(&mem)
-	cr.Memstats = &mem
+	if col.runAsync(ctx, timeout, StageCollect, "memstats", func() error {
+		runtime.ReadMemStats(&mem)
+		return nil
+	}) == nil {
+		cr.Memstats = &mem
+	}
+
+	var build *debug.BuildInfo
+	if col.runAsync(ctx, timeout, StageCollect, "build", func() error {
+		var ok bool
+		if build, ok = debug.ReadBuildInfo(); !ok {
+			return errors.New("build info is not available")
+		}
+		return nil
+	}) == nil {
+		cr.Build = build
+	}
 
 	if !c.NoStack {
-		buf := make([]byte, 1<<16)
-		n := runtime.Stack(buf, true)
-		cr.Stack = string(buf[:n])
+		var stack string
+		if col.runAsync(ctx, timeout, StageCollect, "stack", func() error {
+			stack = stackAll()
+			return nil
+		}) == nil {
+			cr.Stack = stack
+		}
 	}
 
-	if !c.NoSysInfo {
-		cr.SysInfo = newSysInfo()
+	cr.Occurrence = c.Occurrence
+	cr.History = c.History
+	if cr.Identity = c.Identity; cr.Identity == nil {
+		cr.Identity = NewIdentity("", "")
+	}
+	if cr.Occurrence == nil && len(cr.Stack) != 0 {
+		var fingerprint string
+		if col.runAsync(ctx, timeout, StageCollect, "fingerprint", func() error {
+			fingerprint = Fingerprint(cr.Stack, cr.GoroutineID)
+			return nil
+		}) == nil {
+			cr.Occurrence = &Occurrence{Fingerprint: fingerprint}
+		}
 	}
 
-	for profile := range c.Profiles {
-		prof := pprof.Lookup(profile)
-		if prof == nil {
-			return nil, fmt.Errorf("unable to find profile %s", profile)
+	if !c.NoSysInfo {
+		var info *SysInfo
+		if col.runAsync(ctx, timeout, StageCollect, "sysinfo", func() error {
+			info = newSysInfo()
+			return nil
+		}) == nil {
+			cr.SysInfo = info
 		}
+	}
+
+	names, problems := c.CheckProfiles()
+	col.Sections = append(col.Sections, problems...)
+
+	for _, profile := range names {
+		prof, display := c.lookup(profile)
 
-		var buf bytes.Buffer
-		err := prof.WriteTo(&buf, 0)
-		if err != nil {
-			return nil, fmt.Errorf("unable to write profile %s: %w", profile, err)
+		var p *Profile
+		err := col.runAsync(ctx, timeout, StageCollect, "profiles/"+profile, func() (err error) {
+			p, err = collectProfile(prof, profile, display, c.Debug[profile])
+			return err
+		})
+
+		// p must not be read if the section was abandoned.
+		if errors.Is(err, errTimedOut) || errors.Is(err, errSkipped) || p == nil {
+			continue
+		}
+		cr.Profiles = append(cr.Profiles, p)
+
+		if c.Delta {
+			var delta *Profile
+			if col.runAsync(ctx, timeout, StageCollect, "profiles/"+profile+deltaSuffix, func() (err error) {
+				delta, err = deltaProfile(profile, p.profile)
+				return err
+			}) == nil && delta != nil {
+				cr.Profiles = append(cr.Profiles, delta)
+			}
 		}
-		cr.Profiles = append(cr.Profiles, NewProfile(profile, buf.Bytes()))
 	}
 
 	return &cr, nil
 }
 
+// collectProfile writes the profile prof with the given name.
+// display is the name shown in the viewer, if it is empty the name is used.
+// If debug is not zero, the text form of the profile is also included.
+func collectProfile(prof *pprof.Profile, name, display string, debug int) (*Profile, error) {
+	if prof == nil {
+		return nil, fmt.Errorf("unable to find profile %s", name)
+	}
+
+	var buf bytes.Buffer
+	err := prof.WriteTo(&buf, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to write profile %s: %w", name, err)
+	}
+	file := profileFile(name)
+	p := NewProfile(file, buf.Bytes())
+	p.warning = contentionWarning(prof)
+	if display == "" && file != name {
+		display = name
+	}
+	if display != "" {
+		p.name, p.named = display, true
+	}
+
+	if debug > 0 {
+		var text bytes.Buffer
+		if err = prof.WriteTo(&text, debug); err != nil {
+			return p, fmt.Errorf("unable to write profile %s in text form: %w", name, err)
+		}
+		p.text = text.Bytes()
+	}
+
+	return p, nil
+}
+
+// Write writes the crash report to w.
+// Errors writing individual sections are recorded in collection.json and
+// do not stop the rest of the report from being written.
 func (c *CrashReport) Write(w io.Writer) error {
+	return c.WriteContext(context.Background(), w)
+}
+
+// WriteContext writes the crash report to w.
+// Once ctx is done the remaining sections are skipped and marked as timed out,
+// but the written zip file is still valid.
+func (c *CrashReport) WriteContext(ctx context.Context, w io.Writer) error {
 	zw := zip.NewWriter(w)
-	n, err := w.Write([]byte(Header))
+	n, err := io.WriteString(w, Header+c.Identity.header())
 	if err != nil {
 		return fmt.Errorf("unable to write header: %w", err)
 	}
 	zw.SetOffset(int64(n))
 
-	if err = c.writeJSON(zw, "build.json", c.Build); err != nil {
-		return err
+	col := c.Collection.clone()
+	writeJSON := func(name string, v any) {
+		col.run(ctx, StageWrite, name, func() error { return c.writeJSON(zw, name, v) })
 	}
-	if err = c.writeJSON(zw, "memstats.json", c.Memstats); err != nil {
-		return err
+	write := func(name string, data io.Reader) {
+		col.run(ctx, StageWrite, name, func() error { return c.write(zw, name, data) })
 	}
-	if err = c.writeJSON(zw, "system.json", c.SysInfo); err != nil {
-		return err
+
+	writeJSON("report.json", c.Identity)
+	writeJSON("build.json", c.Build)
+	writeJSON("memstats.json", c.Memstats)
+	writeJSON("system.json", c.SysInfo)
+	writeJSON("occurrence.json", c.Occurrence)
+	writeJSON("history.json", c.History)
+	if !c.Metadata.Empty() {
+		writeJSON("metadata.json", c.Metadata)
 	}
-	if err = c.write(zw, "reason", strings.NewReader(c.Reason)); err != nil {
-		return err
+	write("reason", strings.NewReader(c.Reason))
+	write("stack", strings.NewReader(c.Stack))
+	if c.GoroutineID != 0 {
+		write("goroutine", strings.NewReader(strconv.Itoa(c.GoroutineID)))
 	}
-	if err = c.write(zw, "stack", strings.NewReader(c.Stack)); err != nil {
-		return err
+	if len(c.Goroutines) != 0 {
+		writeJSON("goroutines.json", c.Goroutines)
 	}
 
 	for _, profile := range c.Profiles {
-		if err = c.write(zw, profile.Name()+".prof", bytes.NewReader(profile.profile)); err != nil {
-			return err
+		write("profiles/"+profile.file+".prof", bytes.NewReader(profile.profile))
+		if len(profile.text) != 0 {
+			write("profiles/"+profile.file+".txt", bytes.NewReader(profile.text))
+		}
+		if profile.warning != "" {
+			write("profiles/"+profile.file+".warning", strings.NewReader(profile.warning))
+		}
+		if profile.named {
+			write("profiles/"+profile.file+".name", strings.NewReader(profile.name))
 		}
 	}
 
+	used := map[string]struct{}{}
+	for _, a := range c.Attachments {
+		write(includeName(used, a.Name), bytes.NewReader(a.Data))
+	}
+
 	for _, file := range c.Files {
-		if err = c.writeFile(zw, file); err != nil {
-			return err
+		file := file
+		if abs, err := filepath.Abs(file); err == nil {
+			file = abs
 		}
+		name := includeName(used, filepath.Base(file))
+		col.run(ctx, StageWrite, name, func() error {
+			fileCtx := ctx
+			if c.sectionTimeout > 0 {
+				var cancel context.CancelFunc
+				fileCtx, cancel = context.WithTimeout(ctx, c.sectionTimeout)
+				defer cancel()
+			}
+			return c.writeFile(fileCtx, zw, file, name)
+		})
+	}
+
+	// collection.json is written last so it contains the result of every other section.
+	// This is written even if ctx is done so the reader can tell which sections were skipped.
+	if err = c.writeJSON(zw, "collection.json", col); err != nil {
+		return err
 	}
 
 	return zw.Close()
@@ -136,6 +427,9 @@ func (c *CrashReport) writeJSON(z *zip.Writer, name string, v any) error {
 	if v == nil {
 		return nil
 	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil
+	}
 
 	w, err := z.Create(name)
 	if err != nil {
@@ -163,27 +457,64 @@ func (c *CrashReport) write(z *zip.Writer, name string, data io.Reader) error {
 	return nil
 }
 
-func (c *CrashReport) writeFile(zw *zip.Writer, file string) error {
-	var err error
-	if file, err = filepath.Abs(file); err != nil {
+// writeFile includes the given file in the crash report as the entry name.
+// The file is opened and read using ctx so a file that blocks does not block
+// the rest of the report from being written.
+func (c *CrashReport) writeFile(ctx context.Context, zw *zip.Writer, file, name string) error {
+	f, err := openContext(ctx, file)
+	if err != nil {
 		return err
 	}
+	defer f.Close()
 
-	name := filepath.Base(file)
-
-	var f *os.File
-	if f, err = os.Open(file); err != nil {
+	w, err := zw.Create(name)
+	if err != nil {
 		return err
 	}
 
-	w, err := zw.Create("include/" + name)
-	if err != nil {
-		return err
+	_, err = io.Copy(w, &ctxReader{ctx: ctx, r: f})
+	return err
+}
+
+// includeName returns the name of the entry an included file with the given name is written to.
+// A numbered suffix is added to names that are already used, so files with the same
+// name are not written to the same entry.
+func includeName(used map[string]struct{}, name string) string {
+	ext := path.Ext(name)
+	entry := name
+	for i := 2; ; i++ {
+		if _, ok := used[entry]; !ok {
+			break
+		}
+		entry = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), i, ext)
 	}
+	used[entry] = struct{}{}
+	return "include/" + entry
+}
 
-	if _, err = io.Copy(w, f); err != nil {
-		return err
+// openContext opens the given file.
+// If ctx is done before the file is opened, the file is closed once it is opened.
+func openContext(ctx context.Context, name string) (*os.File, error) {
+	type result struct {
+		f   *os.File
+		err error
 	}
 
-	return f.Close()
+	done := make(chan result, 1)
+	go func() {
+		f, err := os.Open(name)
+		done <- result{f, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.f, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-done; res.f != nil {
+				res.f.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
 }
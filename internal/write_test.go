@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeReport creates a report using c and returns the written file.
+func writeReport(tb testing.TB, c Config) []byte {
+	tb.Helper()
+
+	if c.Profiles == nil {
+		c.Profiles = map[string]struct{}{}
+	}
+	report, err := Create(c)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = report.Write(&buf); err != nil {
+		tb.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readBytes reads the report in buf.
+func readBytes(t *testing.T, buf []byte) *CrashReport {
+	t.Helper()
+	report, err := ReadAt(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+// roundTrip creates a report using c, writes it and reads it again.
+func roundTrip(t *testing.T, c Config) *CrashReport {
+	t.Helper()
+	return readBytes(t, writeReport(t, c))
+}
+
+// findProfile returns the profile with the given file name.
+func findProfile(t *testing.T, c *CrashReport, name string) *Profile {
+	t.Helper()
+	for _, p := range c.Profiles {
+		if p.FileName() == name {
+			return p
+		}
+	}
+	t.Fatalf("profile %s not found", name)
+	return nil
+}
+
+func TestTextProfiles(t *testing.T) {
+	c := Config{Profiles: map[string]struct{}{}}
+	ProfileHeap.Add(&c)
+	ProfileGoroutines.AddDebug(&c, 1)
+
+	report := roundTrip(t, c)
+
+	goroutine := findProfile(t, report, "goroutine")
+	if !goroutine.HasText() {
+		t.Fatal("goroutine profile has no text form")
+	}
+	text, err := goroutine.ReadText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(text), "goroutine profile:") {
+		t.Errorf("unexpected text form %.40q", text)
+	}
+	if _, err = goroutine.Profile(); err != nil {
+		t.Errorf("protobuf form was not included: %v", err)
+	}
+
+	if heap := findProfile(t, report, "heap"); heap.HasText() {
+		t.Error("heap profile has a text form")
+	}
+}
+
+func TestSetDebug(t *testing.T) {
+	c := Config{Profiles: map[string]struct{}{}}
+	c.SetDebug("goroutine", 2)
+	if c.Debug["goroutine"] != 2 {
+		t.Fatalf("debug level %d, expected 2", c.Debug["goroutine"])
+	}
+	if _, ok := c.Profiles["goroutine"]; !ok {
+		t.Fatal("profile was not included")
+	}
+
+	c.SetDebug("goroutine", 0)
+	if _, ok := c.Debug["goroutine"]; ok {
+		t.Error("debug level was not removed")
+	}
+	if _, ok := c.Profiles["goroutine"]; !ok {
+		t.Error("profile was removed")
+	}
+
+	report := roundTrip(t, c)
+	if findProfile(t, report, "goroutine").HasText() {
+		t.Error("text form was included with debug level 0")
+	}
+}
+
+func TestDebug2IncludesEveryGoroutine(t *testing.T) {
+	c := Config{Profiles: map[string]struct{}{}}
+	ProfileGoroutines.AddDebug(&c, 2)
+
+	text := findProfile(t, roundTrip(t, c), "goroutine").Text()
+	if !strings.Contains(string(text), "goroutine ") || !strings.Contains(string(text), "[running]") {
+		t.Errorf("debug=2 did not include goroutine stacks: %.80q", text)
+	}
+}
+
+func TestCreateContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report, err := CreateContext(ctx, Config{Reason: []string{"canceled"}, Profiles: map[string]struct{}{"heap": {}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = report.WriteContext(ctx, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	read := readBytes(t, buf.Bytes())
+	if read.Collection == nil || len(read.Collection.Sections) == 0 {
+		t.Fatal("collection was not written")
+	}
+	for _, s := range read.Collection.Sections {
+		if s.Stage != StageRead && !s.TimedOut {
+			t.Errorf("section %s %s was not skipped", s.Stage, s.Name)
+		}
+	}
+}
+
+// createIn creates a report in a new goroutine started by fn.
+func createIn(t *testing.T, fn func(func())) *CrashReport {
+	t.Helper()
+	var report *CrashReport
+	var err error
+	done := make(chan struct{})
+	fn(func() {
+		defer close(done)
+		report, err = Create(Config{Profiles: map[string]struct{}{}})
+	})
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestCreateFingerprintUsesCaller(t *testing.T) {
+	// frames in this module are ignored by the fingerprint so the reports are
+	// told apart by the function that started the calling goroutine.
+	startA := func(f func()) { go f() }
+	startB := func(f func()) { go f() }
+
+	a := createIn(t, startA)
+	b := createIn(t, startB)
+	a2 := createIn(t, startA)
+
+	if a.Occurrence.Fingerprint == b.Occurrence.Fingerprint {
+		t.Error("reports created from different goroutines have the same fingerprint")
+	}
+	if a.Occurrence.Fingerprint != a2.Occurrence.Fingerprint {
+		t.Error("reports created from the same goroutine have different fingerprints")
+	}
+}
+
+func TestIncludeSameName(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "log.txt")
+	if err := os.WriteFile(file, []byte("file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := roundTrip(t, Config{
+		Files: []string{file},
+		Attachments: []*Attachment{
+			{Name: "log.txt", Data: []byte("first")},
+			{Name: "log.txt", Data: []byte("second")},
+		},
+	})
+	if len(report.problems) != 0 {
+		t.Errorf("unexpected problems %+v", report.problems)
+	}
+
+	for name, expected := range map[string]string{
+		"include/log.txt":   "first",
+		"include/log-2.txt": "second",
+		"include/log-3.txt": "file",
+	} {
+		data, err := report.ReadFile(name)
+		if err != nil || string(data) != expected {
+			t.Errorf("%s: got %q, %v, expected %q", name, data, err, expected)
+		}
+	}
+}
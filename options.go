@@ -0,0 +1,161 @@
+package crashreport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/yehan2002/crashreport/internal"
+)
+
+// ErrSuppressed is returned when an automatically produced report was not
+// written because a report with the same fingerprint was written recently.
+var ErrSuppressed = errors.New("crashreport: report suppressed by rate limit")
+
+// Options configures crash reports that are produced automatically
+// (for example by a [Trigger] or [Recover]).
+type Options struct {
+	// Dir the directory reports are written to.
+	// Defaults to the current working directory.
+	Dir string
+
+	// Service the name of the service included in every report, if it is not empty.
+	Service string
+	// Instance the id of the instance of the service included in every report, if it is not empty.
+	Instance string
+
+	// RateLimit the minimum amount of time between two reports with the same fingerprint.
+	// Reports written before this duration has passed are suppressed and counted.
+	// Defaults to 10 minutes. A negative value disables rate limiting.
+	// Reports requested using [WriteOnSignal] are not rate limited, and reports
+	// written by a [Trigger] are limited by [TriggerConfig.Cooldown] instead.
+	RateLimit time.Duration
+
+	// CrashLoopWindow the duration crashes are counted over by [CrashLoopState].
+	// Defaults to 10 minutes. A negative value disables the crash history.
+	CrashLoopWindow time.Duration
+
+	// Uploader if not nil, every report written is also queued for upload.
+	Uploader *Uploader
+
+	// SyncDir syncs the directory after each report is written.
+	// See [CrashReport.SyncDir].
+	SyncDir bool
+
+	// Text if not nil, a text rendering of each report is also written to Text.
+	// This is useful when the only output that is collected is stderr or a log.
+	// See [CrashReport.WriteText].
+	Text io.Writer
+	// TextOnly only writes the text rendering of reports instead of writing report files.
+	// The text rendering is written to os.Stderr if [Options.Text] is nil.
+	TextOnly bool
+}
+
+var (
+	optionsMux sync.RWMutex
+	options    Options
+)
+
+// Configure sets the options used for automatically produced crash reports.
+func Configure(o Options) {
+	optionsMux.Lock()
+	options = o
+	optionsMux.Unlock()
+}
+
+// currentOptions returns a copy of the current options.
+func currentOptions() Options {
+	optionsMux.RLock()
+	defer optionsMux.RUnlock()
+
+	o := options
+	if o.RateLimit == 0 {
+		o.RateLimit = 10 * time.Minute
+	}
+	if o.CrashLoopWindow == 0 {
+		o.CrashLoopWindow = 10 * time.Minute
+	}
+	return o
+}
+
+// writeAuto writes an automatically produced crash report into dir.
+// If [Options.TextOnly] is set, only the text rendering is written and the returned path is empty.
+// If emergency mode is enabled the report is written using [EnableEmergencyMode] instead.
+// If dir is empty [Options.Dir] is used instead.
+// The report includes a summary of the crash history, see [CrashLoopState].
+// kind is used as a prefix for the file name.
+// key is used to compute the fingerprint of the report, if it is empty
+// the fingerprint is computed from the stack of the calling goroutine.
+func writeAuto(dir, kind, key string, c *CrashReport) (string, error) {
+	o := currentOptions()
+	if dir == "" {
+		dir = o.Dir
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", fmt.Errorf("unable to create report directory %s: %w", dir, err)
+		}
+	}
+
+	var fingerprint string
+	if key != "" {
+		fingerprint = internal.FingerprintStrings(kind, key)
+	} else {
+		buf := make([]byte, 1<<14)
+		fingerprint = internal.Fingerprint(string(buf[:runtime.Stack(buf, false)]), 0)
+	}
+
+	// crashes are recorded even if the report is suppressed.
+	c.c.History = crashHistory(dir, kind, fingerprint, c.crash, o.CrashLoopWindow)
+	c.history = true
+
+	var suppressed int
+	if !c.noRateLimit {
+		var ok bool
+		if suppressed, ok = rateLimit(dir, fingerprint, o.RateLimit); !ok {
+			return "", ErrSuppressed
+		}
+	}
+	c.c.Occurrence = &internal.Occurrence{Fingerprint: fingerprint, Suppressed: suppressed}
+
+	if o.TextOnly {
+		if o.Text == nil {
+			o.Text = os.Stderr
+		}
+		return "", c.WriteText(o.Text)
+	}
+
+	if o.SyncDir {
+		c.SyncDir()
+	}
+
+	name := fmt.Sprintf("%s-%s-%d.crash", kind, time.Now().Format("20060102-150405.000"), os.Getpid())
+	path := filepath.Join(dir, name)
+
+	if e, cfg := takeEmergency(); e != nil {
+		path, err := writeEmergency(e, cfg, path, c, &o)
+		if err == nil && o.Uploader != nil {
+			_, err = o.Uploader.enqueueFile(path, c.ID())
+		}
+		return path, err
+	}
+
+	if err := c.writeFile(context.Background(), path, o.Text); err != nil {
+		return path, err
+	}
+
+	if o.Uploader != nil {
+		if _, err := o.Uploader.enqueueFile(path, c.ID()); err != nil {
+			return path, err
+		}
+	}
+
+	return path, nil
+}
@@ -0,0 +1,15 @@
+package crashreport
+
+import "testing"
+
+// configure sets the options used for automatically produced reports until the test finishes.
+func configure(t *testing.T, o Options) {
+	t.Helper()
+
+	optionsMux.Lock()
+	prev := options
+	options = o
+	optionsMux.Unlock()
+
+	t.Cleanup(func() { Configure(prev) })
+}
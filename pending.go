@@ -0,0 +1,201 @@
+package crashreport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yehan2002/crashreport/internal"
+)
+
+// pendingExt the extension of the marker written next to reports that were not acknowledged.
+const pendingExt = ".pending"
+
+// consentFile the name of the file the consent is stored in.
+const consentFile = ".crashreport-consent.json"
+
+// processStart the time this process started.
+var processStart = time.Now()
+
+// PendingReport a report written by a previous run of the program that was not acknowledged.
+// See [PendingReports].
+type PendingReport struct {
+	// ID the id of the report. See [CrashReport.Write].
+	ID string
+	// Path the path of the report file.
+	Path string
+	// Kind the kind of report, either "panic" or "exit".
+	Kind string
+	// Reason the reason the report was written.
+	Reason string
+	// Time the time the report was written.
+	Time time.Time
+	// PID the process id of the program that wrote the report.
+	PID int
+}
+
+var (
+	pendingMux sync.Mutex
+	// pendingDirs the directories passed to PendingReports.
+	pendingDirs = map[string]bool{}
+)
+
+// markPending marks the report at path as pending, so it is returned by [PendingReports]
+// when the program is started again. The marker is named after the id of the report.
+func markPending(path, kind string, c *CrashReport) error {
+	p := &PendingReport{
+		ID:     c.ID(),
+		Path:   path,
+		Kind:   kind,
+		Reason: strings.Join(c.c.Reason, "\n"),
+		Time:   time.Now(),
+		PID:    os.Getpid(),
+	}
+
+	buf, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	marker := filepath.Join(filepath.Dir(path), p.ID+pendingExt)
+	return internal.WriteFile(marker, false, func(w io.Writer) error {
+		_, err := w.Write(buf)
+		return err
+	})
+}
+
+// PendingReports returns the reports in dir that were written by a previous run of
+// the program after a panic (see [Recover]) or a fatal error (see [Exit]), and were not
+// acknowledged using [Acknowledge]. The reports are sorted by the time they were written.
+//
+// This can be used to ask the user whether the reports should be sent when the program starts.
+// See [LoadConsent] for remembering the answer.
+func PendingReports(dir string) ([]*PendingReport, error) {
+	if dir == "" {
+		dir = "."
+	}
+
+	pendingMux.Lock()
+	pendingDirs[dir] = true
+	pendingMux.Unlock()
+
+	markers, err := filepath.Glob(filepath.Join(dir, "*"+pendingExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []*PendingReport
+	for _, marker := range markers {
+		buf, err := os.ReadFile(marker)
+		if err != nil {
+			continue
+		}
+
+		p := &PendingReport{}
+		if err = json.Unmarshal(buf, p); err != nil {
+			continue
+		}
+
+		// reports written by this process are not from a previous run.
+		if p.PID == os.Getpid() && !p.Time.Before(processStart) {
+			continue
+		}
+
+		// the report is in the same directory as the marker, even if dir was moved.
+		// markers written by older versions are named after the report.
+		if p.Path != "" {
+			p.Path = filepath.Join(dir, filepath.Base(p.Path))
+		} else {
+			p.Path = strings.TrimSuffix(marker, pendingExt) + ".crash"
+		}
+		if _, err = os.Stat(p.Path); err != nil {
+			continue
+		}
+		reports = append(reports, p)
+	}
+
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Time.Before(reports[j].Time) })
+	return reports, nil
+}
+
+// Acknowledge marks the report with the given id as acknowledged,
+// so it is no longer returned by [PendingReports]. The report file is not removed.
+// The report must be in [Options.Dir] or in a directory passed to [PendingReports].
+func Acknowledge(id string) error {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return fmt.Errorf("crashreport: invalid report id %q", id)
+	}
+
+	pendingMux.Lock()
+	dirs := []string{currentOptions().Dir}
+	for dir := range pendingDirs {
+		dirs = append(dirs, dir)
+	}
+	pendingMux.Unlock()
+
+	for _, dir := range dirs {
+		err := os.Remove(filepath.Join(dir, id+pendingExt))
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("crashreport: pending report %s: %w", id, fs.ErrNotExist)
+}
+
+// Consent the answer of the user when asked whether reports should be sent.
+type Consent string
+
+// Consent values.
+const (
+	// ConsentUnknown the user was not asked yet.
+	ConsentUnknown Consent = ""
+	// ConsentSend the user agreed to send the reports once.
+	ConsentSend Consent = "send"
+	// ConsentDiscard the user chose not to send the reports.
+	ConsentDiscard Consent = "discard"
+	// ConsentAlways the user agreed to always send reports without being asked.
+	ConsentAlways Consent = "always"
+)
+
+// consentState the contents of the consent file.
+type consentState struct {
+	Consent Consent
+	Time    time.Time
+}
+
+// LoadConsent returns the consent stored in dir using [SaveConsent].
+// [ConsentUnknown] is returned if no consent was stored.
+func LoadConsent(dir string) (Consent, error) {
+	buf, err := os.ReadFile(filepath.Join(dir, consentFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ConsentUnknown, nil
+		}
+		return ConsentUnknown, err
+	}
+
+	var state consentState
+	if err = json.Unmarshal(buf, &state); err != nil {
+		return ConsentUnknown, err
+	}
+	return state.Consent, nil
+}
+
+// SaveConsent stores the consent of the user in dir.
+func SaveConsent(dir string, c Consent) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return writeState(filepath.Join(dir, consentFile), &consentState{Consent: c, Time: time.Now()})
+}
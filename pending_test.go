@@ -0,0 +1,123 @@
+package crashreport
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeMarker writes a pending marker for a report written by a previous run.
+// The report file is created if create is true.
+func writeMarker(t *testing.T, dir, id string, p *PendingReport, create bool) {
+	t.Helper()
+
+	buf, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, id+pendingExt), buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if create {
+		path := p.Path
+		if path == "" {
+			path = filepath.Join(dir, id+".crash")
+		}
+		if err = os.WriteFile(filepath.Join(dir, filepath.Base(path)), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPendingReports(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	writeMarker(t, dir, "b", &PendingReport{ID: "b", Path: "/moved/b.crash", Kind: "exit", Time: now.Add(-time.Minute), PID: 1}, true)
+	writeMarker(t, dir, "a", &PendingReport{ID: "a", Path: "a.crash", Kind: "panic", Time: now.Add(-time.Hour), PID: 1}, true)
+	// markers written by older versions do not contain the path.
+	writeMarker(t, dir, "old", &PendingReport{ID: "old", Time: now.Add(-2 * time.Minute), PID: 1}, true)
+	// the report file was removed.
+	writeMarker(t, dir, "missing", &PendingReport{ID: "missing", Path: "missing.crash", PID: 1}, false)
+	if err := os.WriteFile(filepath.Join(dir, "invalid"+pendingExt), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// reports written by this process are not from a previous run.
+	path := filepath.Join(dir, "current.crash")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := markPending(path, "panic", NewCrashReport("current")); err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := PendingReports(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, r := range reports {
+		ids = append(ids, r.ID)
+	}
+	if len(ids) != 3 || ids[0] != "a" || ids[1] != "old" || ids[2] != "b" {
+		t.Fatalf("unexpected pending reports %v", ids)
+	}
+	if reports[2].Path != filepath.Join(dir, "b.crash") {
+		t.Errorf("path was not resolved relative to dir: %s", reports[2].Path)
+	}
+	if reports[1].Path != filepath.Join(dir, "old.crash") {
+		t.Errorf("path of an old marker was not resolved: %s", reports[1].Path)
+	}
+}
+
+func TestAcknowledge(t *testing.T) {
+	dir := t.TempDir()
+	writeMarker(t, dir, "a", &PendingReport{ID: "a", Path: "a.crash", Time: time.Now(), PID: 1}, true)
+
+	if _, err := PendingReports(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Acknowledge("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if reports, _ := PendingReports(dir); len(reports) != 0 {
+		t.Errorf("acknowledged report is still pending: %v", reports)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.crash")); err != nil {
+		t.Errorf("report file was removed: %v", err)
+	}
+
+	if err := Acknowledge("a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+	for _, id := range []string{"", "../a", `a\b`} {
+		if err := Acknowledge(id); err == nil {
+			t.Errorf("expected an error for the id %q", id)
+		}
+	}
+}
+
+func TestConsent(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+
+	if c, err := LoadConsent(dir); err != nil || c != ConsentUnknown {
+		t.Errorf("got %q, %v before consent was saved", c, err)
+	}
+
+	for _, consent := range []Consent{ConsentAlways, ConsentDiscard} {
+		if err := SaveConsent(dir, consent); err != nil {
+			t.Fatal(err)
+		}
+		if c, err := LoadConsent(dir); err != nil || c != consent {
+			t.Errorf("got %q, %v, expected %q", c, err, consent)
+		}
+	}
+}
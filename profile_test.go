@@ -0,0 +1,60 @@
+package crashreport
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	if err := NewCrashReport("valid").Include(ProfileHeap).Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err := NewCrashReport("invalid").IncludeCustom("").IncludeProfile(nil).Validate()
+	if err == nil || !strings.Contains(err.Error(), "profile name is empty") || !strings.Contains(err.Error(), "profile is nil") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestIncludeCustomRegisteredLater(t *testing.T) {
+	name := fmt.Sprintf("crashreport.test/later-%d", time.Now().UnixNano())
+	c := NewCrashReport("later").IncludeCustom(name)
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "unknown profile") {
+		t.Fatalf("unknown profile was not reported: %v", err)
+	}
+
+	pprof.NewProfile(name)
+	if err := c.Validate(); err != nil {
+		t.Fatalf("profile registered later was not found: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.zip")
+	if err := c.WriteTo(path); err != nil {
+		t.Fatal(err)
+	}
+	p := openReport(t, path).Profile(strings.ReplaceAll(name, "/", "_"))
+	if p == nil || p.DisplayName() != name {
+		t.Errorf("profile was not included: %v", p)
+	}
+}
+
+func TestIncludeProfileNamed(t *testing.T) {
+	name := fmt.Sprintf("crashreport-test-named-%d", time.Now().UnixNano())
+	prof := pprof.NewProfile(name)
+
+	path := filepath.Join(t.TempDir(), "report.zip")
+	if err := NewCrashReport("named").IncludeProfileNamed(prof, "Connections").WriteTo(path); err != nil {
+		t.Fatal(err)
+	}
+	p := openReport(t, path).Profile(name)
+	if p == nil {
+		t.Fatal("profile was not included")
+	}
+	if p.DisplayName() != "Connections" {
+		t.Errorf("unexpected display name %q", p.DisplayName())
+	}
+}
@@ -0,0 +1,84 @@
+package crashreport
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/yehan2002/crashreport/internal"
+)
+
+// stateFile the name of the file used to keep track of written reports.
+const stateFile = ".crashreport-state.json"
+
+// rateLimitMux prevents concurrent updates to the state file from this process.
+var rateLimitMux sync.Mutex
+
+// fingerprintState the state of a single fingerprint.
+type fingerprintState struct {
+	// Last the time the last report with this fingerprint was written.
+	Last time.Time
+	// Suppressed the number of reports suppressed since Last.
+	Suppressed int
+}
+
+// rateLimit checks if a report with the given fingerprint may be written to dir.
+// If the report may be written the number of reports suppressed since the last
+// report is returned. Otherwise the report is counted as suppressed.
+// Errors reading or writing the state file are ignored so that a broken state
+// file never prevents reports from being written.
+func rateLimit(dir, fingerprint string, limit time.Duration) (suppressed int, ok bool) {
+	if limit < 0 {
+		return 0, true
+	}
+
+	rateLimitMux.Lock()
+	defer rateLimitMux.Unlock()
+
+	path := filepath.Join(dir, stateFile)
+
+	state := map[string]*fingerprintState{}
+	if buf, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(buf, &state)
+	}
+
+	now := time.Now()
+	s := state[fingerprint]
+	if s == nil {
+		s = &fingerprintState{}
+		state[fingerprint] = s
+	}
+
+	if !s.Last.IsZero() && now.Sub(s.Last) < limit {
+		s.Suppressed++
+	} else {
+		suppressed, ok = s.Suppressed, true
+		s.Last, s.Suppressed = now, 0
+	}
+
+	// forget fingerprints that have not been seen in a while.
+	for k, v := range state {
+		if now.Sub(v.Last) > limit && v.Suppressed == 0 && k != fingerprint {
+			delete(state, k)
+		}
+	}
+
+	_ = writeState(path, state)
+	return
+}
+
+// writeState atomically replaces the state file at path.
+func writeState(path string, state any) error {
+	buf, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return internal.WriteFile(path, false, func(w io.Writer) error {
+		_, err := w.Write(buf)
+		return err
+	})
+}
@@ -0,0 +1,81 @@
+package crashreport
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yehan2002/crashreport/internal"
+)
+
+func TestRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	const limit = 100 * time.Millisecond
+
+	if suppressed, ok := rateLimit(dir, "a", limit); !ok || suppressed != 0 {
+		t.Fatalf("first report: suppressed=%d ok=%v", suppressed, ok)
+	}
+	for i := 0; i < 2; i++ {
+		if _, ok := rateLimit(dir, "a", limit); ok {
+			t.Fatal("report was not suppressed")
+		}
+	}
+	if _, ok := rateLimit(dir, "b", limit); !ok {
+		t.Fatal("report with another fingerprint was suppressed")
+	}
+
+	time.Sleep(limit + 10*time.Millisecond)
+	if suppressed, ok := rateLimit(dir, "a", limit); !ok || suppressed != 2 {
+		t.Fatalf("report after the limit: suppressed=%d ok=%v, expected 2 suppressed", suppressed, ok)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 3; i++ {
+		if _, ok := rateLimit(dir, "a", -1); !ok {
+			t.Fatal("report was suppressed with rate limiting disabled")
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, stateFile)); !errors.Is(err, os.ErrNotExist) {
+		t.Error("state file was written with rate limiting disabled")
+	}
+}
+
+func TestRateLimitBrokenStateFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, stateFile), []byte("{broken"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rateLimit(dir, "a", time.Minute); !ok {
+		t.Fatal("broken state file suppressed the report")
+	}
+	if _, ok := rateLimit(dir, "a", time.Minute); ok {
+		t.Fatal("state file was not replaced")
+	}
+}
+
+func TestWriteAutoSuppressed(t *testing.T) {
+	dir := t.TempDir()
+	configure(t, Options{Dir: dir})
+
+	path, err := writeAuto("", "test", "key", NewCrashReport("first").NoStack())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := openReport(t, path)
+
+	if fp := internal.FingerprintStrings("test", "key"); r.Fingerprint() != fp {
+		t.Errorf("fingerprint %s, expected %s", r.Fingerprint(), fp)
+	}
+
+	if _, err = writeAuto("", "test", "key", NewCrashReport("second").NoStack()); !errors.Is(err, ErrSuppressed) {
+		t.Errorf("expected ErrSuppressed, got %v", err)
+	}
+	if _, err = writeAuto("", "test", "other", NewCrashReport("other").NoStack()); err != nil {
+		t.Errorf("report with another key was not written: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package crashreport
+
+import (
+	"context"
+	"fmt"
+)
+
+// Recover writes a crash report if the current goroutine is panicking
+// and then continues panicking.
+// The report is written to [Options.Dir].
+//
+// Recover must be deferred directly:
+//
+//	defer crashreport.Recover()
+func Recover() {
+	if r := recover(); r != nil {
+		reportPanic(context.Background(), r)
+		panic(r)
+	}
+}
+
+// RecoverContext is like [Recover] but the report includes the values
+// and pprof labels of ctx. See [FromContext].
+//
+// RecoverContext must be deferred directly:
+//
+//	defer crashreport.RecoverContext(ctx)
+func RecoverContext(ctx context.Context) {
+	if r := recover(); r != nil {
+		reportPanic(ctx, r)
+		panic(r)
+	}
+}
+
+// reportPanic writes a crash report for the panic value r.
+// The report is marked as pending and the crash is recorded in the crash history since
+// the panic is expected to crash the program. See [PendingReports] and [CrashLoopState].
+// This must be called from the panicking goroutine.
+func reportPanic(ctx context.Context, r any) {
+	report := FromContext(ctx)
+	report.crash = true
+	if path, err := writePanic("", report, r); err == nil && path != "" {
+		_ = markPending(path, "panic", report)
+	}
+}
+
+// writePanic adds the panic value r to report and writes it to dir.
+// This must be called from the panicking goroutine.
+func writePanic(dir string, report *CrashReport, r any) (string, error) {
+	report.Reason(fmt.Sprintf("panic: %v", r)).Include(ProfileGoroutines | ProfileHeap)
+	return writeAuto(dir, "panic", "", report)
+}
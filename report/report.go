@@ -0,0 +1,260 @@
+// Package report reads crash report files written by github.com/yehan2002/crashreport.
+//
+// Accessors return nil or the zero value for sections that do not exist in the
+// crash report, for example because they were excluded when the report was written
+// or because the report was written by an older version of this module.
+package report
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+	"runtime/debug"
+	"sort"
+
+	"github.com/google/pprof/profile"
+	"github.com/yehan2002/crashreport/internal"
+)
+
+// SysInfo contains information about the system the process was running in.
+type SysInfo = internal.SysInfo
+
+// Identity identifies a report and the process that wrote it.
+type Identity = internal.Identity
+
+// History a summary of the recent crashes of the program.
+type History = internal.History
+
+// Crash a crash of the program recorded in the crash history.
+type Crash = internal.Crash
+
+// Limits the maximum size of each type of entry read from a crash report.
+// A limit of zero uses the default limit for the entry type and a negative limit disables the limit.
+type Limits = internal.Limits
+
+// Report a crash report.
+type Report struct {
+	c      *internal.CrashReport
+	closer io.Closer
+}
+
+// Open opens the crash report file with the given name.
+// The report must be closed using [Report.Close].
+func Open(name string) (*Report, error) { return OpenLimits(name, Limits{}) }
+
+// OpenLimits is like [Open] but uses the given limits when reading entries.
+func OpenLimits(name string, limits Limits) (*Report, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	r, err := ReadLimits(f, stat.Size(), limits)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	r.closer = f
+	return r, nil
+}
+
+// Read reads a crash report from r.
+// Profiles and attachments are read from r when they are used,
+// so r must remain valid until the report is no longer used.
+//
+// r may be untrusted. Entries that cannot be read are returned by [Report.Problems]
+// and the readable entries of corrupt files are recovered.
+func Read(r io.ReaderAt, size int64) (*Report, error) { return ReadLimits(r, size, Limits{}) }
+
+// ReadLimits is like [Read] but uses the given limits when reading entries.
+func ReadLimits(r io.ReaderAt, size int64, limits Limits) (*Report, error) {
+	c, err := internal.ReadAtLimits(r, size, limits)
+	if err != nil {
+		return nil, err
+	}
+	return &Report{c: c}, nil
+}
+
+// Close closes the underlying file if the report was opened using [Open].
+func (r *Report) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// ID returns the unique id of the report.
+// This is empty if the report was written by an older version of this module.
+func (r *Report) ID() string {
+	if r.c.Identity == nil {
+		return ""
+	}
+	return r.c.Identity.ID
+}
+
+// Identity returns the id of the report and information about the process that wrote it.
+func (r *Report) Identity() *Identity { return r.c.Identity }
+
+// Reason returns the reason the report was created.
+func (r *Report) Reason() string { return r.c.Reason }
+
+// Stack returns the stack trace of all goroutines.
+func (r *Report) Stack() string { return r.c.Stack }
+
+// GoroutineID returns the id of the goroutine that crashed or created the report.
+// This is zero if it is unknown.
+func (r *Report) GoroutineID() int { return r.c.GoroutineID }
+
+// Fingerprint returns the fingerprint computed from the stack of the crashing goroutine.
+func (r *Report) Fingerprint() string {
+	if r.c.Occurrence == nil {
+		return ""
+	}
+	return r.c.Occurrence.Fingerprint
+}
+
+// Suppressed returns the number of similar reports that were not written
+// since the previous report with the same fingerprint.
+func (r *Report) Suppressed() int {
+	if r.c.Occurrence == nil {
+		return 0
+	}
+	return r.c.Occurrence.Suppressed
+}
+
+// History returns a summary of the recent crashes of the program when the report was written.
+func (r *Report) History() *History { return r.c.History }
+
+// SysInfo returns information about the system the process was running in.
+func (r *Report) SysInfo() *SysInfo { return r.c.SysInfo }
+
+// MemStats returns the memory statistics of the process.
+func (r *Report) MemStats() *runtime.MemStats { return r.c.Memstats }
+
+// BuildInfo returns the build info of the binary that created the report.
+func (r *Report) BuildInfo() *debug.BuildInfo { return r.c.Build }
+
+// Metadata returns the key value pairs added to the report.
+func (r *Report) Metadata() map[string]string {
+	if r.c.Metadata == nil {
+		return nil
+	}
+	return r.c.Metadata.Values
+}
+
+// Labels returns the pprof labels of the goroutine that created the report.
+func (r *Report) Labels() map[string]string {
+	if r.c.Metadata == nil {
+		return nil
+	}
+	return r.c.Metadata.Labels
+}
+
+// Problems returns the parts of the report that could not be collected or written,
+// and the entries of the report file that could not be read.
+func (r *Report) Problems() []Problem {
+	var problems []Problem
+	for _, s := range r.c.Collection.Problems() {
+		problems = append(problems, Problem{Section: s.Name, Stage: s.Stage, Error: s.Error, TimedOut: s.TimedOut})
+	}
+	return problems
+}
+
+// Problem a part of the report that could not be collected or written.
+type Problem struct {
+	// Section the name of the section.
+	Section string
+	// Stage either "collect", "write", "read" or "config".
+	Stage string
+	// Error the error that occurred.
+	Error string
+	// TimedOut is true if the section did not finish before the deadline.
+	TimedOut bool
+}
+
+// Profiles returns all profiles in the report.
+func (r *Report) Profiles() []*Profile {
+	profiles := make([]*Profile, 0, len(r.c.Profiles))
+	for _, p := range r.c.Profiles {
+		profiles = append(profiles, &Profile{p: p})
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name() < profiles[j].Name() })
+	return profiles
+}
+
+// Profile returns the profile with the given name, or nil if it does not exist.
+// See [Profile.Name].
+func (r *Report) Profile(name string) *Profile {
+	for _, p := range r.c.Profiles {
+		if p.FileName() == name {
+			return &Profile{p: p}
+		}
+	}
+	return nil
+}
+
+// Profile a profile included in the report.
+type Profile struct{ p *internal.Profile }
+
+// Name returns the name of the profile, for example "heap", "goroutine" or "heap.delta".
+func (p *Profile) Name() string { return p.p.FileName() }
+
+// DisplayName returns the name used for the profile in the viewer, for example "Heap (delta)".
+func (p *Profile) DisplayName() string { return p.p.Name() }
+
+// Profile parses the profile.
+func (p *Profile) Profile() (*profile.Profile, error) { return p.p.Profile() }
+
+// Bytes returns the profile in the gzip compressed protobuf format.
+// nil is returned if the profile cannot be read. See [Profile.ReadBytes].
+func (p *Profile) Bytes() []byte { return p.p.ProfileBytes() }
+
+// ReadBytes reads the profile in the gzip compressed protobuf format.
+func (p *Profile) ReadBytes() ([]byte, error) { return p.p.ReadProfileBytes() }
+
+// HasText checks if the text form of the profile was included.
+func (p *Profile) HasText() bool { return p.p.HasText() }
+
+// Text returns the text form of the profile, or nil if it was not included or cannot be read.
+// See [Profile.ReadText].
+func (p *Profile) Text() []byte { return p.p.Text() }
+
+// ReadText reads the text form of the profile, or returns nil if it was not included.
+func (p *Profile) ReadText() ([]byte, error) { return p.p.ReadText() }
+
+// Warning returns a warning explaining why the profile may be empty.
+func (p *Profile) Warning() string { return p.p.Warning() }
+
+// Attachments returns the files included in the report.
+func (r *Report) Attachments() []*Attachment {
+	attachments := make([]*Attachment, 0, len(r.c.Files))
+	for _, f := range r.c.Files {
+		attachments = append(attachments, &Attachment{c: r.c, path: f})
+	}
+	return attachments
+}
+
+// Attachment a file included in the report.
+type Attachment struct {
+	c    *internal.CrashReport
+	path string
+}
+
+// Name returns the name of the file.
+func (a *Attachment) Name() string { return path.Base(a.path) }
+
+// Open opens the file.
+func (a *Attachment) Open() (fs.File, error) { return a.c.Open(a.path) }
+
+// Bytes reads the whole file.
+// An error is returned if the file is larger than [Limits.File].
+func (a *Attachment) Bytes() ([]byte, error) { return a.c.ReadFile(a.path) }
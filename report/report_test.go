@@ -0,0 +1,149 @@
+package report
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yehan2002/crashreport/internal"
+)
+
+// createReport creates a report using c and returns the written file.
+func createReport(t *testing.T, c internal.Config) []byte {
+	t.Helper()
+
+	if c.Profiles == nil {
+		c.Profiles = map[string]struct{}{}
+	}
+	report, err := internal.Create(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = report.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// read reads the report in buf.
+func read(t *testing.T, buf []byte) *Report {
+	t.Helper()
+	r, err := Read(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRead(t *testing.T) {
+	buf := createReport(t, internal.Config{
+		Reason:      []string{"test", "reason"},
+		Profiles:    map[string]struct{}{"heap": {}},
+		Attachments: []*internal.Attachment{{Name: "log.txt", Data: []byte("log output")}},
+	})
+	r := read(t, buf)
+
+	if r.Reason() != "test\nreason" {
+		t.Errorf("unexpected reason %q", r.Reason())
+	}
+	if !strings.Contains(r.Stack(), "goroutine ") {
+		t.Error("stack was not read")
+	}
+	if r.ID() == "" || r.Identity().PID != os.Getpid() {
+		t.Errorf("unexpected identity %+v", r.Identity())
+	}
+	if r.SysInfo() == nil || r.MemStats() == nil || r.BuildInfo() == nil {
+		t.Error("sys info, memstats or build info were not read")
+	}
+	if len(r.Problems()) != 0 {
+		t.Errorf("unexpected problems %+v", r.Problems())
+	}
+
+	p := r.Profile("heap")
+	if p == nil || len(r.Profiles()) != 1 {
+		t.Fatalf("unexpected profiles %v", r.Profiles())
+	}
+	if _, err := p.Profile(); err != nil {
+		t.Errorf("unable to parse profile: %v", err)
+	}
+	if len(p.Bytes()) == 0 || p.HasText() || p.Text() != nil {
+		t.Error("unexpected profile contents")
+	}
+	if r.Profile("missing") != nil {
+		t.Error("missing profile was returned")
+	}
+
+	attachments := r.Attachments()
+	if len(attachments) != 1 || attachments[0].Name() != "log.txt" {
+		t.Fatalf("unexpected attachments %v", attachments)
+	}
+	if data, err := attachments[0].Bytes(); err != nil || string(data) != "log output" {
+		t.Errorf("got %q, %v", data, err)
+	}
+
+	f, err := attachments[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if data, _ := io.ReadAll(f); string(data) != "log output" {
+		t.Errorf("got %q", data)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.crash")
+	if err := os.WriteFile(path, createReport(t, internal.Config{Reason: []string{"open"}}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Reason() != "open" {
+		t.Errorf("unexpected reason %q", r.Reason())
+	}
+	if err = r.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = Open(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	data := []byte("not a crash report")
+	if _, err := Read(bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestReadLimits(t *testing.T) {
+	buf := createReport(t, internal.Config{
+		Profiles:    map[string]struct{}{"heap": {}},
+		Attachments: []*internal.Attachment{{Name: "log.txt", Data: []byte("log output")}},
+	})
+
+	r, err := ReadLimits(bytes.NewReader(buf), int64(len(buf)), Limits{Profile: 1, File: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := r.Profile("heap")
+	if _, err = p.ReadBytes(); err == nil {
+		t.Error("expected an error for a profile larger than the limit")
+	}
+	if p.Bytes() != nil {
+		t.Error("Bytes returned a profile larger than the limit")
+	}
+	if _, err = r.Attachments()[0].Bytes(); err == nil {
+		t.Error("expected an error for an attachment larger than the limit")
+	}
+}
@@ -0,0 +1,58 @@
+package crashreport
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// WriteOnSignal writes a crash report to [Options.Dir] every time the process receives
+// one of the given signals, for example syscall.SIGUSR1. This can be used to capture the
+// state of a running process on demand. No reports are written if no signals are given.
+//
+// The reports are written by a goroutine and not by the signal handler itself, so
+// writing them is not restricted. [Options.Text] and [Options.TextOnly] apply like for
+// every automatically produced report, so the text rendering can be written to stderr
+// alongside or instead of the report file.
+//
+// A report is written for every signal received, the reports are not limited by [Options.RateLimit].
+//
+// The returned function stops writing reports for the signals.
+func WriteOnSignal(sig ...os.Signal) (stop func()) {
+	if len(sig) == 0 {
+		// signal.Notify relays every signal if none are given.
+		return func() {}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig...)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case s := <-ch:
+				_, _ = writeSignal(s)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// writeSignal writes a crash report for the received signal s.
+// The returned path is empty if only the text rendering was written.
+func writeSignal(s os.Signal) (string, error) {
+	report := NewCrashReport("signal: " + s.String()).Include(ProfileGoroutines | ProfileHeap)
+	// the report was requested, so it is never suppressed.
+	report.noRateLimit = true
+	return writeAuto("", "signal", s.String(), report)
+}
@@ -0,0 +1,80 @@
+package crashreport
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWriteSignalTextOnly(t *testing.T) {
+	dir := t.TempDir()
+	var text bytes.Buffer
+	configure(t, Options{Dir: dir, TextOnly: true, Text: &text})
+
+	path, err := writeSignal(syscall.SIGTERM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "" || len(findReports(t, dir, "signal")) != 0 {
+		t.Errorf("a report file was written: %q", path)
+	}
+	if !strings.Contains(text.String(), "signal: "+syscall.SIGTERM.String()) {
+		t.Errorf("text rendering does not contain the reason:\n%s", text.String())
+	}
+}
+
+func TestWriteOnSignal(t *testing.T) {
+	dir := t.TempDir()
+	var text lockedBuffer
+	configure(t, Options{Dir: dir, Text: &text})
+
+	stop := WriteOnSignal(os.Interrupt)
+	defer stop()
+
+	p, _ := os.FindProcess(os.Getpid())
+	// the second signal is not suppressed by the default rate limit.
+	for i := 1; i <= 2; i++ {
+		// reports are named using the time in milliseconds.
+		time.Sleep(2 * time.Millisecond)
+		if err := p.Signal(os.Interrupt); err != nil {
+			t.Skipf("unable to send a signal: %v", err)
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for len(findReports(t, dir, "signal")) < i || !strings.Contains(text.String(), "signal: ") {
+			if time.Now().After(deadline) {
+				t.Fatalf("no report was written for signal %d:\n%s", i, text.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	stop()
+	stop()
+
+	if r := openReport(t, findReports(t, dir, "signal")[0]); r.Reason() != "signal: "+os.Interrupt.String() {
+		t.Errorf("unexpected reason %q", r.Reason())
+	}
+}
+
+// lockedBuffer a [bytes.Buffer] that can be used concurrently.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
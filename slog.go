@@ -0,0 +1,109 @@
+//go:build go1.21
+
+package crashreport
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LevelFatal the level used for fatal log messages.
+// See [NewSlogHandler].
+const LevelFatal = slog.Level(12)
+
+// SlogHandler a [slog.Handler] that writes a crash report and exits the process
+// after handling a record with a fatal level. See [Exit].
+type SlogHandler struct {
+	next  slog.Handler
+	fatal slog.Leveler
+
+	// attrs the attributes added using WithAttrs, already prefixed with their group.
+	attrs []slog.Attr
+	// group the prefix of attributes added to the handler.
+	group string
+}
+
+// NewSlogHandler wraps next so records with a level of at least fatal are passed to next
+// and then a crash report is written before the process exits with code 1.
+// If fatal is nil [LevelFatal] is used.
+//
+// The attributes of the record are included in the report as metadata.
+// The values and pprof labels of the context passed to the logger are included
+// like [FromContext].
+func NewSlogHandler(next slog.Handler, fatal slog.Leveler) *SlogHandler {
+	if fatal == nil {
+		fatal = LevelFatal
+	}
+	return &SlogHandler{next: next, fatal: fatal}
+}
+
+// Enabled reports whether next handles records with the given level.
+// Fatal records are always enabled.
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.fatal.Level() || h.next.Enabled(ctx, level)
+}
+
+// Handle passes r to next. If r has a fatal level a crash report is written and the process exits.
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	if h.next.Enabled(ctx, r.Level) {
+		err = h.next.Handle(ctx, r)
+	}
+
+	if r.Level < h.fatal.Level() {
+		return err
+	}
+
+	report := FromContext(ctx).Reason("fatal: " + r.Message)
+	for _, a := range h.attrs {
+		setAttr(report, "", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		setAttr(report, h.group, a)
+		return true
+	})
+
+	exit(report, 1)
+	return err
+}
+
+// WithAttrs returns a handler with the given attributes.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.next = h.next.WithAttrs(attrs)
+	h2.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = append(h2.attrs, slog.Attr{Key: h.group + a.Key, Value: a.Value})
+	}
+	return &h2
+}
+
+// WithGroup returns a handler that adds the given group to the attributes.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.next = h.next.WithGroup(name)
+	h2.group = h.group + name + "."
+	return &h2
+}
+
+// setAttr adds a to the metadata of report. Groups are flattened using "." as a separator.
+func setAttr(report *CrashReport, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, a := range v.Group() {
+			setAttr(report, prefix, a)
+		}
+		return
+	}
+
+	if a.Key != "" {
+		report.Set("log."+prefix+a.Key, v.String())
+	}
+}
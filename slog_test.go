@@ -0,0 +1,55 @@
+//go:build go1.21
+
+package crashreport
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+func init() {
+	helpers["slog"] = func() {
+		h := NewSlogHandler(slog.NewTextHandler(os.Stderr, nil), nil)
+		ctx := WithContextValues(context.Background(), "user", "42")
+		slog.New(h).With("a", 1).WithGroup("g").Log(ctx, LevelFatal, "slog fatal", "b", 2)
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	dir, _, code := runHelper(t, "slog")
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+
+	files := findReports(t, dir, "exit")
+	if len(files) != 1 {
+		t.Fatalf("expected 1 report, got %v", files)
+	}
+
+	r := openReport(t, files[0])
+	if r.Reason() != "fatal: slog fatal" {
+		t.Errorf("unexpected reason %q", r.Reason())
+	}
+	m := r.Metadata()
+	for k, v := range map[string]string{"log.a": "1", "log.g.b": "2", "user": "42"} {
+		if m[k] != v {
+			t.Errorf("%s: got %q, expected %q", k, m[k], v)
+		}
+	}
+}
+
+func TestSlogHandlerNotFatal(t *testing.T) {
+	dir := t.TempDir()
+	configure(t, Options{Dir: dir})
+
+	h := NewSlogHandler(slog.NewTextHandler(&lockedBuffer{}, nil), nil)
+	slog.New(h).Error("not fatal")
+	if !h.Enabled(context.Background(), LevelFatal) || h.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("unexpected enabled levels")
+	}
+	if files := findReports(t, dir, "exit"); len(files) != 0 {
+		t.Errorf("a report was written for a message that is not fatal: %v", files)
+	}
+}
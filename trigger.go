@@ -0,0 +1,219 @@
+package crashreport
+
+import (
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TriggerConfig configures a [Trigger].
+// A threshold that is zero is disabled.
+type TriggerConfig struct {
+	// HeapBytes the number of bytes occupied by live and unswept heap objects.
+	HeapBytes uint64
+	// Goroutines the number of live goroutines.
+	Goroutines uint64
+	// OpenFDs the number of open file descriptors.
+	// This is ignored on platforms where the number of open files cannot be determined.
+	OpenFDs uint64
+	// GCCPUFraction the fraction of the CPU time used by the GC since the previous check.
+	// This is computed from the /cpu/classes metrics of [runtime/metrics], which require Go 1.20.
+	GCCPUFraction float64
+
+	// Interval how often the thresholds are checked. Defaults to 1 second.
+	Interval time.Duration
+	// Cooldown the minimum amount of time between two reports. Defaults to 5 minutes.
+	// Reports written by a trigger are not limited by [Options.RateLimit].
+	Cooldown time.Duration
+	// Hysteresis the fraction a value must drop below its threshold before
+	// the threshold can trigger again. Defaults to 0.1.
+	Hysteresis float64
+
+	// Dir the directory reports are written to. Defaults to [Options.Dir].
+	Dir string
+	// Profiles the profiles included in the report.
+	// Defaults to the heap, allocs and goroutine profiles.
+	Profiles Profiles
+	// OnReport is called after a report was written, if it is not nil.
+	OnReport func(path string, err error)
+}
+
+// Trigger writes crash reports when resource usage crosses a threshold.
+type Trigger struct {
+	cfg       TriggerConfig
+	resources []*resource
+	last      time.Time
+
+	// gcCPU and totalCPU the cumulative CPU time used by the GC and in total at the previous check.
+	gcCPU, totalCPU float64
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// resource a single value monitored by a [Trigger].
+type resource struct {
+	name      string
+	threshold float64
+	armed     bool
+	value     float64
+	ok        bool
+}
+
+// StartTrigger starts monitoring the thresholds in cfg.
+// The returned trigger must be stopped using [Trigger.Stop].
+func StartTrigger(cfg TriggerConfig) *Trigger {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 5 * time.Minute
+	}
+	if cfg.Hysteresis <= 0 {
+		cfg.Hysteresis = 0.1
+	}
+	if cfg.Profiles == 0 {
+		cfg.Profiles = ProfileHeap | ProfileAllocs | ProfileGoroutines
+	}
+
+	t := &Trigger{cfg: cfg, stop: make(chan struct{}), done: make(chan struct{})}
+	for _, r := range []*resource{
+		{name: "heap bytes", threshold: float64(cfg.HeapBytes)},
+		{name: "goroutines", threshold: float64(cfg.Goroutines)},
+		{name: "open file descriptors", threshold: float64(cfg.OpenFDs)},
+		{name: "GC CPU fraction", threshold: cfg.GCCPUFraction},
+	} {
+		r.armed = true
+		t.resources = append(t.resources, r)
+	}
+
+	go t.run()
+	return t
+}
+
+// Stop stops the trigger. It waits until any report that is being written is finished.
+func (t *Trigger) Stop() {
+	t.stopOnce.Do(func() { close(t.stop) })
+	<-t.done
+}
+
+func (t *Trigger) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			t.check()
+		}
+	}
+}
+
+// check reads the current values and writes a report if any threshold was crossed.
+func (t *Trigger) check() {
+	t.read()
+	t.evaluate()
+}
+
+// evaluate writes a report if any threshold was crossed.
+func (t *Trigger) evaluate() {
+	var crossed, names []string
+	for _, r := range t.resources {
+		if r.threshold == 0 || !r.ok {
+			continue
+		}
+
+		switch {
+		case r.armed && r.value >= r.threshold:
+			crossed = append(crossed, fmt.Sprintf("%s %v exceeded threshold %v", r.name, r.value, r.threshold))
+			names = append(names, r.name)
+		case !r.armed && r.value < r.threshold*(1-t.cfg.Hysteresis):
+			r.armed = true
+		}
+	}
+
+	if len(crossed) == 0 || time.Since(t.last) < t.cfg.Cooldown {
+		return
+	}
+
+	report := NewCrashReport(crossed...).Include(t.cfg.Profiles)
+	// reports are limited by the cooldown instead of the rate limit.
+	report.noRateLimit = true
+	path, err := writeAuto(t.cfg.Dir, "trigger", strings.Join(names, ","), report)
+	if t.cfg.OnReport != nil {
+		t.cfg.OnReport(path, err)
+	}
+	if errors.Is(err, ErrSuppressed) {
+		return
+	}
+
+	for _, r := range t.resources {
+		if r.threshold != 0 && r.ok && r.value >= r.threshold {
+			r.armed = false
+		}
+	}
+	t.last = time.Now()
+}
+
+// read updates the values of all resources with a non zero threshold.
+func (t *Trigger) read() {
+	heap, goroutines, fds, gc := t.resources[0], t.resources[1], t.resources[2], t.resources[3]
+
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/heap/objects:bytes"},
+		{Name: "/sched/goroutines:goroutines"},
+		{Name: "/cpu/classes/gc/total:cpu-seconds"},
+		{Name: "/cpu/classes/total:cpu-seconds"},
+	}
+	metrics.Read(samples)
+
+	heap.value, heap.ok = sampleValue(samples[0])
+	goroutines.value, goroutines.ok = sampleValue(samples[1])
+
+	if fds.threshold != 0 {
+		var n int
+		n, fds.ok = openFDs()
+		fds.value = float64(n)
+	}
+
+	// the fraction is computed between checks, since the cumulative fraction
+	// barely changes in a process that has been running for a while.
+	gcCPU, gcOK := sampleValue(samples[2])
+	totalCPU, totalOK := sampleValue(samples[3])
+	gc.ok = false
+	if gcOK && totalOK {
+		gc.value, gc.ok = cpuFraction(gcCPU-t.gcCPU, totalCPU-t.totalCPU)
+		// there is no previous check to compare to.
+		if t.totalCPU == 0 {
+			gc.ok = false
+		}
+		t.gcCPU, t.totalCPU = gcCPU, totalCPU
+	}
+}
+
+// cpuFraction returns the fraction of total CPU time used.
+// false is returned if no CPU time was used.
+func cpuFraction(used, total float64) (float64, bool) {
+	if total <= 0 {
+		return 0, false
+	}
+	return used / total, true
+}
+
+func sampleValue(s metrics.Sample) (float64, bool) {
+	switch s.Value.Kind() {
+	case metrics.KindUint64:
+		return float64(s.Value.Uint64()), true
+	case metrics.KindFloat64:
+		return s.Value.Float64(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,169 @@
+package crashreport
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTriggerWritesReport(t *testing.T) {
+	dir := t.TempDir()
+	configure(t, Options{Dir: dir})
+
+	type result struct {
+		path string
+		err  error
+	}
+	results := make(chan result, 10)
+
+	tr := StartTrigger(TriggerConfig{
+		Goroutines: 1,
+		Interval:   10 * time.Millisecond,
+		Profiles:   ProfileGoroutines,
+		OnReport:   func(path string, err error) { results <- result{path, err} },
+	})
+	defer tr.Stop()
+
+	var res result
+	select {
+	case res = <-results:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no report was written")
+	}
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if !strings.HasPrefix(res.path, dir) {
+		t.Errorf("report written to %s, expected it to be in %s", res.path, dir)
+	}
+
+	r := openReport(t, res.path)
+
+	if !strings.Contains(r.Reason(), "goroutines") {
+		t.Errorf("unexpected reason %q", r.Reason())
+	}
+	if r.Profile("goroutine") == nil {
+		t.Error("goroutine profile was not included")
+	}
+
+	select {
+	case res = <-results:
+		t.Errorf("report %s written during the cooldown", res.path)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTriggerHysteresis(t *testing.T) {
+	configure(t, Options{Dir: t.TempDir(), RateLimit: -1})
+
+	reports := 0
+	r := &resource{name: "test", threshold: 100, armed: true}
+	tr := &Trigger{
+		cfg: TriggerConfig{
+			Hysteresis: 0.1,
+			Profiles:   ProfileGoroutines,
+			OnReport:   func(string, error) { reports++ },
+		},
+		resources: []*resource{r},
+	}
+
+	for _, step := range []struct {
+		value   float64
+		reports int
+	}{
+		{50, 0},
+		{100, 1},
+		{120, 1}, // still above the threshold
+		{95, 1},  // not below the hysteresis
+		{89, 1},  // rearmed
+		{100, 2},
+	} {
+		r.value, r.ok = step.value, true
+		tr.evaluate()
+		if reports != step.reports {
+			t.Fatalf("value %v: got %d reports, expected %d", step.value, reports, step.reports)
+		}
+	}
+}
+
+func TestTriggerCooldown(t *testing.T) {
+	dir := t.TempDir()
+	// the default rate limit does not apply to reports written by a trigger.
+	configure(t, Options{Dir: dir})
+
+	var errs []error
+	r := &resource{name: "test", threshold: 100, armed: true}
+	tr := &Trigger{
+		cfg: TriggerConfig{
+			Cooldown:   time.Hour,
+			Hysteresis: 0.1,
+			Profiles:   ProfileGoroutines,
+			OnReport:   func(_ string, err error) { errs = append(errs, err) },
+		},
+		resources: []*resource{r},
+	}
+
+	for _, value := range []float64{100, 50, 100} {
+		r.value, r.ok = value, true
+		tr.evaluate()
+	}
+	if len(errs) != 1 {
+		t.Fatalf("got %d reports during the cooldown, expected 1", len(errs))
+	}
+
+	// reports are named using the time in milliseconds.
+	time.Sleep(2 * time.Millisecond)
+	tr.last = time.Time{}
+	tr.evaluate()
+	if len(errs) != 2 || errs[1] != nil {
+		t.Fatalf("report after the cooldown was not written: %v", errs)
+	}
+	if reports := findReports(t, dir, "trigger"); len(reports) != 2 {
+		t.Errorf("expected 2 reports, got %v", reports)
+	}
+}
+
+func TestTriggerGCCPUFraction(t *testing.T) {
+	tr := &Trigger{resources: []*resource{{}, {}, {}, {threshold: 0.5}}}
+	gc := tr.resources[3]
+
+	tr.read()
+	if gc.ok {
+		t.Fatal("the fraction must not be available before the second check")
+	}
+
+	for i := 0; i < 100 && !gc.ok; i++ {
+		buf := make([][]byte, 0, 1024)
+		for j := 0; j < cap(buf); j++ {
+			buf = append(buf, make([]byte, 1024))
+		}
+		_ = buf
+		runtime.GC()
+		tr.read()
+	}
+
+	if !gc.ok {
+		t.Skip("cpu metrics are not available")
+	}
+	if gc.value < 0 || gc.value > 1 {
+		t.Errorf("invalid fraction %v", gc.value)
+	}
+}
+
+func TestCPUFraction(t *testing.T) {
+	for _, tc := range []struct {
+		used, total, fraction float64
+		ok                    bool
+	}{
+		{1, 4, 0.25, true},
+		{0, 4, 0, true},
+		{1, 0, 0, false},
+		{1, -1, 0, false},
+	} {
+		fraction, ok := cpuFraction(tc.used, tc.total)
+		if fraction != tc.fraction || ok != tc.ok {
+			t.Errorf("cpuFraction(%v, %v) = %v, %v, expected %v, %v", tc.used, tc.total, fraction, ok, tc.fraction, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package crashreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yehan2002/crashreport/internal"
+)
+
+// UploaderConfig configures an [Uploader].
+type UploaderConfig struct {
+	// URL the endpoint reports are posted to.
+	URL string
+	// QueueDir the directory reports are spooled to before they are uploaded.
+	QueueDir string
+
+	// Multipart uploads reports as a multipart/form-data request instead of
+	// posting the raw report.
+	Multipart bool
+	// FieldName the name of the form field used for multipart uploads.
+	// Defaults to "report".
+	FieldName string
+
+	// Header extra headers sent with every request.
+	Header http.Header
+	// Auth is called to add authentication to every request, if it is not nil.
+	// See [BasicAuth] and [BearerAuth].
+	Auth func(*http.Request) error
+	// Client the http client used to upload reports. Defaults to [http.DefaultClient].
+	Client *http.Client
+
+	// MinBackoff the delay after the first failed upload. Defaults to 1 second.
+	MinBackoff time.Duration
+	// MaxBackoff the maximum delay between two attempts. Defaults to 1 hour.
+	MaxBackoff time.Duration
+	// MaxAttempts the number of attempts after which a report is dropped.
+	// Zero retries forever.
+	MaxAttempts int
+	// Interval how often the queue is checked for reports that are due. Defaults to 5 seconds.
+	Interval time.Duration
+
+	// OnUpload is called after each upload attempt, if it is not nil.
+	OnUpload func(name string, err error)
+}
+
+// BasicAuth authenticates requests using HTTP basic authentication.
+func BasicAuth(username, password string) func(*http.Request) error {
+	return func(r *http.Request) error { r.SetBasicAuth(username, password); return nil }
+}
+
+// BearerAuth authenticates requests using a bearer token.
+func BearerAuth(token string) func(*http.Request) error {
+	return func(r *http.Request) error { r.Header.Set("Authorization", "Bearer "+token); return nil }
+}
+
+// Uploader uploads crash reports to a http endpoint.
+// Reports are first written to a queue directory so uploads are resumed
+// after the process restarts.
+type Uploader struct {
+	cfg UploaderConfig
+
+	mux   sync.Mutex
+	queue chan struct{}
+
+	stop     chan struct{}
+	done     chan struct{}
+	start    sync.Once
+	stopOnce sync.Once
+}
+
+// uploadState the state of a queued report.
+// This is stored next to the report in the queue directory.
+type uploadState struct {
+	Attempts int
+	Next     time.Time
+	Error    string
+}
+
+const (
+	queueExt = ".crash"
+	stateExt = ".json"
+)
+
+// NewUploader creates a new uploader.
+// Reports already in cfg.QueueDir are uploaded once the uploader is started.
+func NewUploader(cfg UploaderConfig) (*Uploader, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("crashreport: uploader url is empty")
+	}
+	if cfg.QueueDir == "" {
+		return nil, errors.New("crashreport: uploader queue directory is empty")
+	}
+	if cfg.FieldName == "" {
+		cfg.FieldName = "report"
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Hour
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+
+	if err := os.MkdirAll(cfg.QueueDir, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create queue directory %s: %w", cfg.QueueDir, err)
+	}
+
+	return &Uploader{
+		cfg:   cfg,
+		queue: make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}, nil
+}
+
+// Enqueue writes the crash report to the queue directory.
+// The name of the queued report is returned. This is the id of the report
+// unless a report with the same id is already queued.
+func (u *Uploader) Enqueue(c *CrashReport) (string, error) {
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		return "", err
+	}
+	return u.enqueue(&buf, c.ID())
+}
+
+// EnqueueFile copies an existing crash report file to the queue directory.
+// The name of the queued report is returned. This is the id of the report
+// if the report has one.
+func (u *Uploader) EnqueueFile(path string) (string, error) {
+	return u.enqueueFile(path, "")
+}
+
+// enqueueFile copies the crash report file at path to the queue directory using the id of the report as the name.
+// If id is empty, only the identity of the report is read from the file.
+func (u *Uploader) enqueueFile(path, id string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if id == "" {
+		if stat, err := f.Stat(); err == nil {
+			if identity, err := internal.ReadIdentity(f, stat.Size()); err == nil {
+				id = identity.ID
+			}
+		}
+	}
+
+	return u.enqueue(f, id)
+}
+
+// enqueue writes the report read from r to the queue directory using the given name.
+// A new name is created if name is empty, not a valid file name or already queued.
+func (u *Uploader) enqueue(r io.Reader, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\.`) {
+		name = internal.NewID()
+	} else if _, err := os.Lstat(u.path(name, queueExt)); err == nil {
+		name = internal.NewID()
+	}
+
+	tmp, err := os.CreateTemp(u.cfg.QueueDir, ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(u.cfg.QueueDir, name+queueExt))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("unable to queue report: %w", err)
+	}
+
+	select {
+	case u.queue <- struct{}{}:
+	default:
+	}
+
+	return name, nil
+}
+
+// Start starts uploading queued reports in the background.
+func (u *Uploader) Start() {
+	u.start.Do(func() { go u.run() })
+}
+
+// Stop stops uploading reports. Reports that were not uploaded stay in the queue.
+func (u *Uploader) Stop() {
+	u.stopOnce.Do(func() { close(u.stop) })
+	u.start.Do(func() { close(u.done) })
+	<-u.done
+}
+
+func (u *Uploader) run() {
+	defer close(u.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { <-u.stop; cancel() }()
+
+	ticker := time.NewTicker(u.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		_ = u.upload(ctx, false)
+
+		select {
+		case <-u.stop:
+			return
+		case <-ticker.C:
+		case <-u.queue:
+		}
+	}
+}
+
+// Flush tries to upload every queued report immediately, ignoring backoff.
+// The first error encountered is returned.
+func (u *Uploader) Flush(ctx context.Context) error {
+	return u.upload(ctx, true)
+}
+
+// Pending returns the names of all reports that have not been uploaded yet.
+func (u *Uploader) Pending() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(u.cfg.QueueDir, "*"+queueExt))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		names = append(names, strings.TrimSuffix(filepath.Base(m), queueExt))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// upload uploads all queued reports that are due.
+func (u *Uploader) upload(ctx context.Context, force bool) (err error) {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	names, err := u.Pending()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		state := u.readState(name)
+		if !force && time.Now().Before(state.Next) {
+			continue
+		}
+
+		uerr := u.send(ctx, name)
+		if u.cfg.OnUpload != nil {
+			u.cfg.OnUpload(name, uerr)
+		}
+
+		if uerr == nil {
+			u.remove(name)
+			continue
+		}
+		if err == nil {
+			err = uerr
+		}
+
+		state.Attempts++
+		state.Error = uerr.Error()
+		state.Next = time.Now().Add(u.backoff(state.Attempts))
+		if u.cfg.MaxAttempts > 0 && state.Attempts >= u.cfg.MaxAttempts {
+			u.remove(name)
+			continue
+		}
+		_ = writeState(u.path(name, stateExt), state)
+	}
+
+	return err
+}
+
+// backoff returns the delay after the given number of failed attempts.
+func (u *Uploader) backoff(attempts int) time.Duration {
+	d := u.cfg.MinBackoff
+	for i := 1; i < attempts && d < u.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > u.cfg.MaxBackoff {
+		d = u.cfg.MaxBackoff
+	}
+	// add up to 10% jitter so multiple processes do not retry at the same time.
+	return d + time.Duration(rand.Int63n(int64(d)/10+1))
+}
+
+// send uploads a single report.
+func (u *Uploader) send(ctx context.Context, name string) error {
+	buf, err := os.ReadFile(u.path(name, queueExt))
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader = bytes.NewReader(buf)
+	contentType := "application/zip"
+
+	if u.cfg.Multipart {
+		var form bytes.Buffer
+		mw := multipart.NewWriter(&form)
+		fw, err := mw.CreateFormFile(u.cfg.FieldName, name+queueExt)
+		if err != nil {
+			return err
+		}
+		if _, err = fw.Write(buf); err != nil {
+			return err
+		}
+		if err = mw.Close(); err != nil {
+			return err
+		}
+		body, contentType = &form, mw.FormDataContentType()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.cfg.URL, body)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range u.cfg.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	if u.cfg.Auth != nil {
+		if err = u.cfg.Auth(req); err != nil {
+			return err
+		}
+	}
+
+	resp, err := u.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("crashreport: upload of %s failed: %s", name, resp.Status)
+	}
+	return nil
+}
+
+func (u *Uploader) readState(name string) (state uploadState) {
+	if buf, err := os.ReadFile(u.path(name, stateExt)); err == nil {
+		_ = json.Unmarshal(buf, &state)
+	}
+	return
+}
+
+// remove removes a report from the queue.
+// The state is removed first, so a report is only no longer pending once the state is gone.
+func (u *Uploader) remove(name string) {
+	os.Remove(u.path(name, stateExt))
+	os.Remove(u.path(name, queueExt))
+}
+
+func (u *Uploader) path(name, ext string) string {
+	return filepath.Join(u.cfg.QueueDir, name+ext)
+}
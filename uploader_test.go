@@ -0,0 +1,334 @@
+package crashreport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// uploadServer a test server that records the uploaded reports.
+type uploadServer struct {
+	*httptest.Server
+
+	mux      sync.Mutex
+	requests []*uploadRequest
+	// fail the number of requests that fail before requests succeed.
+	fail int
+}
+
+// uploadRequest a request received by [uploadServer].
+type uploadRequest struct {
+	header http.Header
+	body   []byte
+	// file the uploaded file for multipart uploads.
+	file     []byte
+	filename string
+}
+
+func newUploadServer(t *testing.T) *uploadServer {
+	s := &uploadServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &uploadRequest{header: r.Header.Clone()}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			f, h, err := r.FormFile("report")
+			if err != nil {
+				t.Errorf("invalid multipart body: %v", err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.file, _ = io.ReadAll(f)
+			req.filename = h.Filename
+		} else {
+			req.body, _ = io.ReadAll(r.Body)
+		}
+
+		s.mux.Lock()
+		defer s.mux.Unlock()
+
+		s.requests = append(s.requests, req)
+		if len(s.requests) <= s.fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *uploadServer) received() []*uploadRequest {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]*uploadRequest(nil), s.requests...)
+}
+
+func newTestUploader(t *testing.T, cfg UploaderConfig) *Uploader {
+	t.Helper()
+	if cfg.QueueDir == "" {
+		cfg.QueueDir = t.TempDir()
+	}
+	u, err := NewUploader(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(u.Stop)
+	return u
+}
+
+func TestUploaderMultipart(t *testing.T) {
+	s := newUploadServer(t)
+	u := newTestUploader(t, UploaderConfig{
+		URL:       s.URL,
+		Multipart: true,
+		Header:    http.Header{"X-Test": {"value"}},
+		Auth:      BearerAuth("token"),
+	})
+
+	c := NewCrashReport("upload").NoStack()
+	name, err := u.Enqueue(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != c.ID() {
+		t.Errorf("queued as %s, expected the report id %s", name, c.ID())
+	}
+	queued, err := os.ReadFile(u.path(name, queueExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = u.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := s.received()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, expected 1", len(requests))
+	}
+	req := requests[0]
+	if !bytes.Equal(req.file, queued) {
+		t.Error("uploaded file does not match the queued report")
+	}
+	if req.filename != name+queueExt {
+		t.Errorf("uploaded file name %s, expected %s", req.filename, name+queueExt)
+	}
+	if got := req.header.Get("X-Test"); got != "value" {
+		t.Errorf("X-Test header %q", got)
+	}
+	if got := req.header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization header %q", got)
+	}
+
+	if pending, _ := u.Pending(); len(pending) != 0 {
+		t.Errorf("uploaded reports are still queued: %v", pending)
+	}
+}
+
+func TestUploaderRaw(t *testing.T) {
+	s := newUploadServer(t)
+	u := newTestUploader(t, UploaderConfig{URL: s.URL, Auth: BasicAuth("user", "pass")})
+
+	if _, err := u.Enqueue(NewCrashReport("upload").NoStack()); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := s.received()
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, expected 1", len(requests))
+	}
+	if got := requests[0].header.Get("Content-Type"); got != "application/zip" {
+		t.Errorf("Content-Type %q", got)
+	}
+	if !bytes.HasPrefix(requests[0].body, []byte("crashreport\n")) {
+		t.Error("body is not a crash report")
+	}
+	if !strings.HasPrefix(requests[0].header.Get("Authorization"), "Basic ") {
+		t.Error("basic auth was not used")
+	}
+}
+
+func TestUploaderRetry(t *testing.T) {
+	s := newUploadServer(t)
+	s.fail = 2
+
+	var mux sync.Mutex
+	var errs []error
+	u := newTestUploader(t, UploaderConfig{
+		URL:        s.URL,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+		Interval:   5 * time.Millisecond,
+		OnUpload: func(name string, err error) {
+			mux.Lock()
+			errs = append(errs, err)
+			mux.Unlock()
+		},
+	})
+
+	name, err := u.Enqueue(NewCrashReport("retry").NoStack())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the failed attempt is recorded and delays the next attempt.
+	if err = u.upload(context.Background(), false); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected the upload to fail with 503, got %v", err)
+	}
+	state := u.readState(name)
+	if state.Attempts != 1 || !state.Next.After(time.Now()) || state.Error == "" {
+		t.Fatalf("unexpected state after a failed upload: %+v", state)
+	}
+	if err = u.upload(context.Background(), false); err != nil {
+		t.Fatalf("report was retried before the backoff expired: %v", err)
+	}
+
+	u.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if pending, _ := u.Pending(); len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("report was not uploaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	if len(errs) != 3 || errs[0] == nil || errs[1] == nil || errs[2] != nil {
+		t.Errorf("unexpected upload results: %v", errs)
+	}
+	if _, err = os.Stat(u.path(name, stateExt)); !os.IsNotExist(err) {
+		t.Error("state file was not removed after the upload")
+	}
+}
+
+func TestUploaderMaxAttempts(t *testing.T) {
+	s := newUploadServer(t)
+	s.fail = 10
+	u := newTestUploader(t, UploaderConfig{URL: s.URL, MaxAttempts: 2})
+
+	if _, err := u.Enqueue(NewCrashReport("dropped").NoStack()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := u.Flush(context.Background()); err == nil {
+			t.Fatal("expected the upload to fail")
+		}
+	}
+	if pending, _ := u.Pending(); len(pending) != 0 {
+		t.Errorf("report was not dropped after the maximum number of attempts: %v", pending)
+	}
+}
+
+func TestUploaderRestart(t *testing.T) {
+	s := newUploadServer(t)
+	s.fail = 1
+	dir := t.TempDir()
+
+	u := newTestUploader(t, UploaderConfig{URL: s.URL, QueueDir: dir})
+	name, err := u.Enqueue(NewCrashReport("restart").NoStack())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = u.Flush(context.Background()); err == nil {
+		t.Fatal("expected the first upload to fail")
+	}
+	u.Stop()
+
+	// a new uploader using the same directory uploads the spooled report.
+	u = newTestUploader(t, UploaderConfig{URL: s.URL, QueueDir: dir})
+	pending, err := u.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0] != name {
+		t.Fatalf("pending reports %v, expected [%s]", pending, name)
+	}
+	if state := u.readState(name); state.Attempts != 1 {
+		t.Errorf("attempts were not kept: %+v", state)
+	}
+
+	if err = u.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ = u.Pending(); len(pending) != 0 {
+		t.Errorf("report was not uploaded: %v", pending)
+	}
+}
+
+func TestUploaderFlushAndStop(t *testing.T) {
+	s := newUploadServer(t)
+	u := newTestUploader(t, UploaderConfig{URL: s.URL, Interval: time.Hour})
+
+	for i := 0; i < 3; i++ {
+		if _, err := u.Enqueue(NewCrashReport("flush").NoStack()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// flushing ignores the backoff of reports that failed.
+	s.fail = 1
+	if err := u.Flush(context.Background()); err == nil {
+		t.Fatal("expected the first upload to fail")
+	}
+	if err := u.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := u.Pending(); len(pending) != 0 {
+		t.Errorf("reports were not flushed: %v", pending)
+	}
+	if n := len(s.received()); n != 4 {
+		t.Errorf("got %d requests, expected 4", n)
+	}
+
+	u.Start()
+	done := make(chan struct{})
+	go func() {
+		u.Stop()
+		u.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+}
+
+func TestUploaderEnqueueFile(t *testing.T) {
+	u := newTestUploader(t, UploaderConfig{URL: "http://localhost", QueueDir: t.TempDir()})
+
+	path := filepath.Join(t.TempDir(), "report.crash")
+	c := NewCrashReport("file").NoStack()
+	if err := c.WriteTo(path); err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := u.EnqueueFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != c.ID() {
+		t.Errorf("queued as %s, expected the report id %s", name, c.ID())
+	}
+
+	// the same report is queued again using a new name.
+	again, err := u.EnqueueFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == name {
+		t.Error("report was queued using the same name twice")
+	}
+}